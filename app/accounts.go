@@ -0,0 +1,95 @@
+package app
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultAccount names the account kept where single-account setups keep
+// their token, used when no other account is picked.
+const DefaultAccount = "default"
+
+// accountName matches the names usable in file names and keyring entries.
+var accountName = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Account is a named Gmail account from config.json, with its own token.
+type Account struct {
+	Name string `json:"name"`
+	// Credentials is the OAuth client file of the account, see LoadCredentials.
+	Credentials string `json:"credentials,omitempty"`
+	// TokenStore overrides the token_store setting for the account.
+	TokenStore string `json:"token_store,omitempty"`
+}
+
+// Account returns the named account, or the default_account when name is empty.
+func (config *Config) Account(name string) (*Account, error) {
+	if name == "" {
+		name = config.DefaultAccount
+	}
+	if name == "" {
+		name = DefaultAccount
+	}
+	if !accountName.MatchString(name) || name == "." || name == ".." {
+		return nil, fmt.Errorf("account name %q must be made of letters, digits, '.', '_' and '-', and not be . or ..", name)
+	}
+	for _, account := range config.Accounts {
+		if account.Name != name {
+			continue
+		}
+		if account.TokenStore == "" {
+			account.TokenStore = config.TokenStore
+		}
+		return account, nil
+	}
+	if name == DefaultAccount {
+		return &Account{Name: DefaultAccount, TokenStore: config.TokenStore}, nil
+	}
+	return nil, fmt.Errorf("unknown account %q, expected one of %s", name, strings.Join(config.AccountNames(), ", "))
+}
+
+// AccountNames lists the configured accounts, the default one first.
+func (config *Config) AccountNames() []string {
+	names := []string{DefaultAccount}
+	for _, account := range config.Accounts {
+		if account.Name != DefaultAccount {
+			names = append(names, account.Name)
+		}
+	}
+	return names
+}
+
+// OpenTokenStore opens the token store of the account.
+func (account *Account) OpenTokenStore() (TokenStore, error) {
+	return OpenTokenStore(account.TokenStore, account.Name)
+}
+
+// SameAccount reports whether two account names are the same, treating the
+// empty name of state saved by older versions as the default account.
+func SameAccount(a, b string) bool {
+	if a == "" {
+		a = DefaultAccount
+	}
+	if b == "" {
+		b = DefaultAccount
+	}
+	return a == b
+}
+
+// accountDataPath returns the path of a state file of the named account. The
+// default account keeps its files at the top of the DataDir, where they were
+// before there were several accounts.
+func accountDataPath(account, name string) string {
+	if account == "" || account == DefaultAccount {
+		return dataPath(name)
+	}
+	return dataPath("accounts", account, name)
+}
+
+// tokenName returns the keyring entry and file name prefix of the account's token.
+func (account *Account) tokenName() string {
+	if account.Name == "" || account.Name == DefaultAccount {
+		return "token"
+	}
+	return "token-" + account.Name
+}
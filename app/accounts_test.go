@@ -0,0 +1,79 @@
+package app
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestConfigAccount(t *testing.T) {
+	config := &Config{
+		TokenStore: "keyring",
+		Accounts: []*Account{
+			{Name: "work", Credentials: "work.json"},
+			{Name: "personal", TokenStore: "encrypted"},
+		},
+	}
+	tests := []struct {
+		config     *Config
+		name       string
+		expected   string
+		tokenStore string
+		wantErr    bool
+	}{
+		{config: config, name: "", expected: DefaultAccount, tokenStore: "keyring"},
+		{config: config, name: "default", expected: DefaultAccount, tokenStore: "keyring"},
+		{config: config, name: "work", expected: "work", tokenStore: "keyring"},
+		{config: config, name: "personal", expected: "personal", tokenStore: "encrypted"},
+		{config: config, name: "other", wantErr: true},
+		{config: config, name: "../work", wantErr: true},
+		{config: config, name: `a\b`, wantErr: true},
+		{config: config, name: ".", wantErr: true},
+		{config: config, name: "..", wantErr: true},
+		{config: config, name: "work mail", wantErr: true},
+		{config: config, name: "wörk", wantErr: true},
+		{config: &Config{Accounts: []*Account{{Name: ".."}}}, name: "..", wantErr: true},
+		{config: &Config{Accounts: []*Account{{Name: "a.b_c-1"}}}, name: "a.b_c-1", expected: "a.b_c-1"},
+		{config: &Config{DefaultAccount: "work", Accounts: config.Accounts}, name: "", expected: "work", tokenStore: "keyring"},
+		{config: &Config{Accounts: []*Account{{Name: DefaultAccount, TokenStore: "file"}}}, name: "", expected: DefaultAccount, tokenStore: "file"},
+	}
+	for _, test := range tests {
+		account, err := test.config.Account(test.name)
+		if (err != nil) != test.wantErr {
+			t.Errorf("Account(%q) error = %v, wantErr %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if account.Name != test.expected || account.TokenStore != test.tokenStore {
+			t.Errorf("Account(%q) = %s with %q store, expected %s with %q store", test.name, account.Name, account.TokenStore, test.expected, test.tokenStore)
+		}
+	}
+}
+
+func TestAccountNames(t *testing.T) {
+	config := &Config{Accounts: []*Account{{Name: "work"}, {Name: DefaultAccount}, {Name: "personal"}}}
+	expected := []string{DefaultAccount, "work", "personal"}
+	if names := config.AccountNames(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("AccountNames() = %v, expected %v", names, expected)
+	}
+}
+
+func TestAccountDataPath(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", dir)
+	tests := []struct {
+		account  string
+		expected string
+	}{
+		{"", filepath.Join(dir, "thanthi", "contacts.json")},
+		{DefaultAccount, filepath.Join(dir, "thanthi", "contacts.json")},
+		{"work", filepath.Join(dir, "thanthi", "accounts", "work", "contacts.json")},
+	}
+	for _, test := range tests {
+		if path := accountDataPath(test.account, "contacts.json"); path != test.expected {
+			t.Errorf("accountDataPath(%q) = %s, expected %s", test.account, path, test.expected)
+		}
+	}
+}
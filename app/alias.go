@@ -0,0 +1,62 @@
+package app
+
+import (
+	"net/mail"
+	"strings"
+)
+
+// LoadAliases fetches the verified send-as addresses of the account.
+// The primary address is always the first alias.
+func (mailer *Mailer) LoadAliases() error {
+	mailer.Aliases = []string{mailer.User}
+	resp, err := mailer.Service.Users.Settings.SendAs.List(mailer.User).Do()
+	if err != nil {
+		return err
+	}
+	for _, sendAs := range resp.SendAs {
+		if strings.EqualFold(sendAs.SendAsEmail, mailer.User) {
+			continue
+		}
+		if sendAs.IsPrimary || sendAs.VerificationStatus == "accepted" {
+			mailer.Aliases = append(mailer.Aliases, sendAs.SendAsEmail)
+		}
+	}
+	return nil
+}
+
+// IsAlias reports whether address may be used in the From header.
+func (mailer *Mailer) IsAlias(address string) bool {
+	for _, alias := range mailer.Aliases {
+		if strings.EqualFold(alias, address) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextAlias returns the alias following from, wrapping around to the primary address.
+func (mailer *Mailer) NextAlias(from string) string {
+	for index, alias := range mailer.Aliases {
+		if strings.EqualFold(alias, from) {
+			return mailer.Aliases[(index+1)%len(mailer.Aliases)]
+		}
+	}
+	return mailer.User
+}
+
+// ReplyAlias returns the alias the message was addressed to so replies go
+// out from the same identity. Defaults to the primary address.
+func (mailer *Mailer) ReplyAlias(msg *Message) string {
+	for _, field := range []string{msg.To, msg.CC} {
+		addresses, err := mail.ParseAddressList(field)
+		if err != nil {
+			continue
+		}
+		for _, address := range addresses {
+			if mailer.IsAlias(address.Address) {
+				return address.Address
+			}
+		}
+	}
+	return mailer.User
+}
@@ -4,11 +4,11 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
 	"strings"
-	"text/tabwriter"
+	"sync"
+	"time"
 
 	"github.com/ajithnn/thanthi/logger"
 	"gitlab.com/golang-commonmark/markdown"
@@ -25,45 +25,70 @@ type Thread struct {
 	ID       string
 	Subject  string
 	Snippet  string
+	LabelIDs []string
 	Messages []*Message
 }
 
 type Message struct {
+	ID        string
 	From      string
+	To        string
 	CC        string
 	BCC       string
 	Reply     string
 	Body      string
 	MessageID string
+	Date      time.Time
+	// Headers holds every header of the message keyed by lower-cased name.
+	Headers map[string]string
 }
 
 type ComposeParams struct {
-	Mode     string
-	To       string
-	Bcc      string
-	Cc       string
-	Subject  string
-	Body     string
-	ThreadID string
+	Mode        string
+	From        string
+	To          string
+	Bcc         string
+	Cc          string
+	Subject     string
+	Body        string
+	ThreadID    string
+	NoSignature bool
 }
 
 type Mailer struct {
-	Service          *gmail.Service
-	User             string
+	Service *gmail.Service
+	// Account is the name of the configured account signed in.
+	Account  string
+	User     string
+	Aliases  []string
+	Contacts *Contacts
+	Config   *Config
+	Rules    []*Rule
+	// Scopes are the OAuth scopes granted to the saved token.
+	Scopes           []string
 	Threads          []*Thread
 	Labels           []string
 	Pages            []string
 	CurrentPageIndex int
+
+	// OnReauth is called once when the saved sign-in turns out to be revoked or expired.
+	OnReauth func()
+
+	// signaturesMu guards signatures, as the TUI sends queued mail off its main loop.
+	signaturesMu sync.Mutex
+	signatures   map[string]string
+	labelCache   []*gmail.Label
+	tokens       *savingTokenSource
 }
 
-func NewMailer(creds []byte, label string) (*Mailer, error) {
-	// If modifying these scopes, delete your previously saved token.json.
-	config, err := google.ConfigFromJSON(creds, gmail.MailGoogleComScope)
+func NewMailer(creds []byte, label string, account *Account) (*Mailer, error) {
+	// The scopes are those granted with the saved token, set by getClient.
+	config, err := google.ConfigFromJSON(creds)
 	if err != nil {
 		return &Mailer{}, err
 	}
 
-	client, err := getClient(config)
+	client, tokens, err := getClient(config, account)
 	if err != nil {
 		return &Mailer{}, err
 	}
@@ -73,39 +98,35 @@ func NewMailer(creds []byte, label string) (*Mailer, error) {
 		return &Mailer{}, err
 	}
 
-	resp, err := srv.Users.GetProfile("me").Do()
-	if err != nil {
-		return &Mailer{}, err
-	}
-
-	return &Mailer{
+	mailer := &Mailer{
 		Service: srv,
-		User:    resp.EmailAddress,
+		Account: account.Name,
 		Labels:  strings.Split(label, ","),
 		Pages:   []string{""},
-	}, nil
-}
-
-func (mailer *Mailer) DeleteAll(labels []string) error {
-	err := mailer.Service.Users.Messages.List(mailer.User).LabelIds(labels...).MaxResults(500).Pages(context.Background(), mailer.deleteMessages)
+		Scopes:  config.Scopes,
+		tokens:  tokens,
+	}
+	tokens.onRevoke = mailer.revoked
+	mailer.User, err = mailer.accountAddress()
 	if err != nil {
-		return err
+		return &Mailer{}, err
 	}
-	return nil
-}
-
-func (mailer *Mailer) ListLabels() error {
-	resp, err := mailer.Service.Users.Labels.List(mailer.User).Do()
+	if err := mailer.LoadAliases(); err != nil {
+		logger.NewLogger().Infof("NewMailer: Unable to load send-as aliases: %v", err)
+	}
+	mailer.Config, err = LoadConfig()
 	if err != nil {
-		return err
+		logger.NewLogger().Infof("NewMailer: Unable to load config: %v", err)
 	}
-
-	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.TabIndent)
-	for _, label := range resp.Labels {
-		fmt.Fprintf(w, "ID: %s \t\t\t\t\t\t\t\t\t Name: %s\n", label.Id, label.Name)
+	mailer.Rules, err = LoadRules(configPath("rules.yml"))
+	if err != nil {
+		logger.NewLogger().Infof("NewMailer: Unable to load rules: %v", err)
 	}
-	w.Flush()
-	return nil
+	mailer.Contacts, err = LoadContacts(mailer.Account)
+	if err != nil {
+		logger.NewLogger().Infof("NewMailer: Unable to load contacts: %v", err)
+	}
+	return mailer, nil
 }
 
 func (mailer *Mailer) ListMail(mode string) error {
@@ -113,6 +134,10 @@ func (mailer *Mailer) ListMail(mode string) error {
 	var err error
 	var resp *gmail.ListThreadsResponse
 
+	if err := mailer.Require(CapRead); err != nil {
+		return err
+	}
+
 	mailer.Threads = make([]*Thread, 0)
 	switch mode {
 	case "init":
@@ -145,41 +170,99 @@ func (mailer *Mailer) ListMail(mode string) error {
 		return err
 	}
 
+	// Muted threads only stay out of the inbox, other label views still show them.
+	muted := map[string]string{}
+	if contains(mailer.Labels, "INBOX") {
+		state, stateErr := LoadThreadState(mailer.Account)
+		if stateErr != nil {
+			logger.NewLogger().Infof("Mailer#ListMail: Unable to load muted threads: %v", stateErr)
+		} else {
+			muted = state.Muted
+		}
+	}
 	for _, thread := range resp.Threads {
-		resp, err := mailer.Service.Users.Threads.Get(mailer.User, thread.Id).Format("full").Do()
+		if _, isMuted := muted[thread.Id]; isMuted {
+			if mailer.Can(CapModify) {
+				if err := mailer.Archive(&Thread{ID: thread.Id}); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		curThread, err := mailer.FetchThread(thread.Id)
 		if err != nil {
 			return err
 		}
-		curThread := &Thread{ID: thread.Id, Snippet: thread.Snippet}
-		for _, msg := range resp.Messages {
-			curMsg := &Message{}
-			for _, header := range msg.Payload.Headers {
-				switch header.Name {
-				case "Subject":
-					if curThread.Subject == "" {
-						curThread.Subject = header.Value
-					}
-				case "From":
-					curMsg.From = header.Value
-				case "Cc":
-					curMsg.CC = header.Value
-				case "Bcc":
-					curMsg.BCC = header.Value
-				case "Reply-To":
-					curMsg.Reply = header.Value
-				case "Message-ID":
-					curMsg.MessageID = header.Value
-				}
+		curThread.Snippet = thread.Snippet
+		if mailer.Rules != nil {
+			hidden, err := mailer.ApplyRules(curThread)
+			if err != nil {
+				logger.NewLogger().Infof("Mailer#ListMail: Rules failed on %s: %v", curThread.ID, err)
+			}
+			if hidden {
+				continue
 			}
-			curMsg.ExtractMessage(msg)
-			curThread.Messages = append(curThread.Messages, curMsg)
 		}
 		mailer.Threads = append(mailer.Threads, curThread)
 	}
+	if mailer.Contacts != nil {
+		if err := mailer.Contacts.Save(); err != nil {
+			logger.NewLogger().Infof("Mailer#ListMail: Unable to save contacts: %v", err)
+		}
+	}
 	return err
 }
 
+// FetchThread loads a thread with its messages, harvesting their addresses into the contacts.
+func (mailer *Mailer) FetchThread(id string) (*Thread, error) {
+	if err := mailer.Require(CapRead); err != nil {
+		return nil, err
+	}
+	resp, err := mailer.Service.Users.Threads.Get(mailer.User, id).Format("full").Do()
+	if err != nil {
+		return nil, err
+	}
+	curThread := &Thread{ID: id, Snippet: resp.Snippet, LabelIDs: threadLabels(resp)}
+	for _, msg := range resp.Messages {
+		curMsg := &Message{
+			ID:      msg.Id,
+			Date:    time.Unix(0, msg.InternalDate*int64(time.Millisecond)),
+			Headers: make(map[string]string),
+		}
+		for _, header := range msg.Payload.Headers {
+			curMsg.Headers[strings.ToLower(header.Name)] = header.Value
+			switch header.Name {
+			case "Subject":
+				if curThread.Subject == "" {
+					curThread.Subject = header.Value
+				}
+			case "From":
+				curMsg.From = header.Value
+			case "To":
+				curMsg.To = header.Value
+			case "Cc":
+				curMsg.CC = header.Value
+			case "Bcc":
+				curMsg.BCC = header.Value
+			case "Reply-To":
+				curMsg.Reply = header.Value
+			case "Message-ID":
+				curMsg.MessageID = header.Value
+			}
+		}
+		curMsg.ExtractMessage(msg)
+		curThread.Messages = append(curThread.Messages, curMsg)
+		if mailer.Contacts != nil {
+			mailer.Contacts.HarvestMessage(msg.Id, curMsg.Date, curMsg.From, curMsg.To, curMsg.CC)
+		}
+	}
+	return curThread, nil
+}
+
 func (mailer *Mailer) MarkAsRead(thread *Thread) error {
+	if err := mailer.Require(CapModify); err != nil {
+		return err
+	}
 	modReq := &gmail.ModifyThreadRequest{
 		RemoveLabelIds: []string{"UNREAD"},
 	}
@@ -190,11 +273,57 @@ func (mailer *Mailer) MarkAsRead(thread *Thread) error {
 	return nil
 }
 
+// Archive removes the thread from the inbox.
+func (mailer *Mailer) Archive(thread *Thread) error {
+	if err := mailer.Require(CapModify); err != nil {
+		return err
+	}
+	modReq := &gmail.ModifyThreadRequest{
+		RemoveLabelIds: []string{"INBOX"},
+	}
+	_, err := mailer.Service.Users.Threads.Modify(mailer.User, thread.ID, modReq).Do()
+	return err
+}
+
+// Trash moves the thread to the trash.
+func (mailer *Mailer) Trash(thread *Thread) error {
+	if err := mailer.Require(CapModify); err != nil {
+		return err
+	}
+	_, err := mailer.Service.Users.Threads.Trash(mailer.User, thread.ID).Do()
+	return err
+}
+
+// Untrash restores the thread from the trash.
+func (mailer *Mailer) Untrash(thread *Thread) error {
+	if err := mailer.Require(CapModify); err != nil {
+		return err
+	}
+	_, err := mailer.Service.Users.Threads.Untrash(mailer.User, thread.ID).Do()
+	return err
+}
+
+// Delete permanently deletes the thread, bypassing the trash.
+func (mailer *Mailer) Delete(thread *Thread) error {
+	if err := mailer.Require(CapDelete); err != nil {
+		return err
+	}
+	return mailer.Service.Users.Threads.Delete(mailer.User, thread.ID).Do()
+}
+
 func (mailer *Mailer) ComposeAndSend(params *ComposeParams, replyID string) error {
 
 	var headers string
-	md := markdown.New(markdown.XHTMLOutput(true))
-	msg := md.RenderToString([]byte(params.Body))
+	if err := mailer.Require(CapSend); err != nil {
+		return err
+	}
+	if err := ValidateRecipients(params); err != nil {
+		return err
+	}
+	if params.From == "" {
+		params.From = mailer.User
+	}
+	msg := mailer.RenderBody(params)
 
 	// RFC2822 Format for EMAIL Messages
 	// Headers \r\n\r\n
@@ -204,8 +333,8 @@ func (mailer *Mailer) ComposeAndSend(params *ComposeParams, replyID string) erro
 	case "forward":
 		fallthrough
 	case "new":
-		headers = "From: " + mailer.User + "\r\n" +
-			"Reply-To: " + mailer.User + "\r\n" +
+		headers = "From: " + params.From + "\r\n" +
+			"Reply-To: " + params.From + "\r\n" +
 			"To: " + params.To + "\r\n" +
 			"Cc: " + params.Cc + "\r\n" +
 			"Bcc: " + params.Bcc + "\r\n" +
@@ -213,8 +342,8 @@ func (mailer *Mailer) ComposeAndSend(params *ComposeParams, replyID string) erro
 			"Content-Type: text/html;\r\n\r\n"
 	case "reply":
 		reply := strings.Split(replyID, " ")
-		headers = "From: " + mailer.User + "\r\n" +
-			"Reply-To: " + mailer.User + "\r\n" +
+		headers = "From: " + params.From + "\r\n" +
+			"Reply-To: " + params.From + "\r\n" +
 			"To: " + params.To + "\r\n" +
 			"Cc: " + params.Cc + "\r\n" +
 			"Bcc: " + params.Bcc + "\r\n" +
@@ -227,6 +356,23 @@ func (mailer *Mailer) ComposeAndSend(params *ComposeParams, replyID string) erro
 	return mailer.sendMail(base64.URLEncoding.EncodeToString([]byte(headers+msg)), params.ThreadID)
 }
 
+// RenderMarkdown converts a markdown mail body to the HTML that is sent.
+func RenderMarkdown(body string) string {
+	md := markdown.New(markdown.XHTMLOutput(true))
+	return md.RenderToString([]byte(body))
+}
+
+// PreviewMarkdown renders a markdown mail body and converts the resulting
+// HTML back to terminal text, showing what the recipient will see.
+func PreviewMarkdown(body string) (string, error) {
+	return HTMLToText(RenderMarkdown(body))
+}
+
+// HTMLToText converts rendered HTML to text suitable for the terminal.
+func HTMLToText(html string) (string, error) {
+	return html2text.FromString(html, html2text.Options{PrettyTables: true})
+}
+
 func (mailer *Mailer) sendMail(msg, threadId string) error {
 	mesg := &gmail.Message{}
 	mesg.Raw = msg
@@ -235,15 +381,6 @@ func (mailer *Mailer) sendMail(msg, threadId string) error {
 	return err
 }
 
-func (mailer *Mailer) deleteMessages(r *gmail.ListMessagesResponse) error {
-	msgIds := make([]string, 0)
-	for _, l := range r.Messages {
-		msgIds = append(msgIds, l.Id)
-	}
-	err := mailer.Service.Users.Messages.BatchDelete(mailer.User, &gmail.BatchDeleteMessagesRequest{Ids: msgIds}).Do()
-	return err
-}
-
 func (m *Message) ExtractMessage(msg *gmail.Message) {
 	var body []byte
 	mimeType := strings.Split(msg.Payload.MimeType, "/")
@@ -278,45 +415,45 @@ func (m *Message) ExtractMessage(msg *gmail.Message) {
 	}
 }
 
-func FetchToken(creds []byte) error {
-	tokFile := "configs/token.json"
-	os.Remove(tokFile)
-	config, err := google.ConfigFromJSON(creds, gmail.MailGoogleComScope)
+func FetchToken(creds []byte, scopes []string, account *Account) error {
+	store, err := account.OpenTokenStore()
+	if err != nil {
+		return err
+	}
+	config, err := google.ConfigFromJSON(creds, scopes...)
 	if err != nil {
 		return err
 	}
 
-	tok := getTokenFromWeb(config)
-	saveToken(tokFile, tok)
-	return nil
-}
-
-// Retrieve a token, saves the token, then returns the generated client.
-func getClient(config *oauth2.Config) (*http.Client, error) {
-	tokFile := "configs/token.json"
-	tok, err := tokenFromFile(tokFile)
+	tok, err := LoopbackToken(config, os.Stdin, os.Stdout)
 	if err != nil {
-		return &http.Client{}, err
+		return err
+	}
+	stored := &StoredToken{Token: *tok, Scopes: grantedScopes(tok, scopes)}
+	for _, scope := range scopes {
+		if !contains(stored.Scopes, scope) {
+			fmt.Printf("Warning: %s was not granted\n", scope)
+		}
 	}
-	return config.Client(context.Background(), tok), nil
+	return saveToken(store, stored)
 }
 
-// Request a token from the web, then returns the retrieved token.
-func getTokenFromWeb(config *oauth2.Config) *oauth2.Token {
-	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-	fmt.Printf("Open the following link in your browser: \n%v\n", authURL)
-
-	var authCode string
-	fmt.Printf("Enter Auth Code: ")
-	if _, err := fmt.Scan(&authCode); err != nil {
-		log.Fatalf("Unable to read authorization code: %v", err)
+// Retrieve a token, then returns the generated client, which saves refreshed tokens.
+func getClient(config *oauth2.Config, account *Account) (*http.Client, *savingTokenSource, error) {
+	store, err := account.OpenTokenStore()
+	if err != nil {
+		return &http.Client{}, nil, err
+	}
+	tok, err := store.Load()
+	if os.IsNotExist(err) {
+		return &http.Client{}, nil, fmt.Errorf("no token in the %s, run thanthi -configure", store)
 	}
-
-	tok, err := config.Exchange(context.TODO(), authCode)
 	if err != nil {
-		log.Fatalf("Unable to retrieve token from web: %v", err)
+		return &http.Client{}, nil, err
 	}
-	return tok
+	config.Scopes = tok.GrantedScopes()
+	tokens := newSavingTokenSource(config, store, tok)
+	return oauth2.NewClient(context.Background(), tokens), tokens, nil
 }
 
 // Retrieves a token from a local file.
@@ -331,13 +468,17 @@ func tokenFromFile(file string) (*oauth2.Token, error) {
 	return tok, err
 }
 
-// Saves a token to a file path.
-func saveToken(path string, token *oauth2.Token) {
-	fmt.Printf("Saving credential file to: %s\n", path)
-	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
-	if err != nil {
-		log.Fatalf("Unable to cache oauth token: %v", err)
+// Saves a token to the token store.
+func saveToken(store TokenStore, token *StoredToken) error {
+	fmt.Printf("Saving credentials to: %s\n", store)
+	return store.Save(token)
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
 	}
-	defer f.Close()
-	json.NewEncoder(f).Encode(token)
+	return false
 }
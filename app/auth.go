@@ -0,0 +1,243 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ajithnn/thanthi/logger"
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/gmail/v1"
+)
+
+// ErrReauthorize is returned once the saved refresh token was revoked or has expired.
+var ErrReauthorize = errors.New("sign-in revoked or expired, run thanthi -configure")
+
+// IsReauthRequired reports whether err means the account has to be signed in again.
+func IsReauthRequired(err error) bool {
+	return errors.Is(err, ErrReauthorize)
+}
+
+// savingTokenSource refreshes tokens through the OAuth config and writes
+// each new token back to the store, so refreshes survive restarts.
+type savingTokenSource struct {
+	mu       sync.Mutex
+	config   *oauth2.Config
+	store    TokenStore
+	base     oauth2.TokenSource
+	last     *oauth2.Token
+	scopes   []string
+	revoked  bool
+	onRevoke func()
+}
+
+func newSavingTokenSource(config *oauth2.Config, store TokenStore, tok *StoredToken) *savingTokenSource {
+	return &savingTokenSource{
+		config: config,
+		store:  store,
+		base:   config.TokenSource(context.Background(), &tok.Token),
+		last:   &tok.Token,
+		scopes: tok.Scopes,
+	}
+}
+
+func (src *savingTokenSource) Token() (*oauth2.Token, error) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	if src.revoked {
+		return nil, ErrReauthorize
+	}
+	tok, err := src.base.Token()
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == "invalid_grant" {
+		src.revoked = true
+		if src.onRevoke != nil {
+			go src.onRevoke()
+		}
+		return nil, ErrReauthorize
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tok.AccessToken != src.last.AccessToken {
+		if err := src.store.Save(&StoredToken{Token: *tok, Scopes: src.scopes}); err != nil {
+			logger.NewLogger().Infof("TokenSource#Token: Unable to save refreshed token: %v", err)
+		}
+		src.last = tok
+	}
+	return tok, nil
+}
+
+// reset switches to a freshly issued token.
+func (src *savingTokenSource) reset(tok *StoredToken) error {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	if err := src.store.Save(tok); err != nil {
+		return err
+	}
+	src.base = src.config.TokenSource(context.Background(), &tok.Token)
+	src.last = &tok.Token
+	src.scopes = tok.Scopes
+	src.revoked = false
+	return nil
+}
+
+func (mailer *Mailer) revoked() {
+	logger.NewLogger().Infof("Mailer#Revoked: %v", ErrReauthorize)
+	if mailer.OnReauth != nil {
+		mailer.OnReauth()
+	}
+}
+
+// accountAddress returns the signed in address, from the Gmail profile when
+// mail may be read and else from the token info, e.g. for send-only sign-ins.
+func (mailer *Mailer) accountAddress() (string, error) {
+	if mailer.Can(CapRead) {
+		resp, err := mailer.Service.Users.GetProfile("me").Do()
+		if err != nil {
+			return "", err
+		}
+		return resp.EmailAddress, nil
+	}
+	tok, err := mailer.tokens.Token()
+	if err != nil {
+		return "", err
+	}
+	info, err := fetchTokenInfo(tok.AccessToken)
+	if err != nil {
+		return "", err
+	}
+	if info.Email == "" {
+		return "", fmt.Errorf("unable to find the signed in address, sign in again with thanthi -configure")
+	}
+	return info.Email, nil
+}
+
+// Reauthorize signs the account in again with the loopback flow, writing the
+// instructions to out and reading a pasted redirect address or code from in,
+// and carries on with the new token.
+func (mailer *Mailer) Reauthorize(in io.Reader, out io.Writer) error {
+	config := mailer.tokens.config
+	tok, err := LoopbackToken(config, in, out)
+	if err != nil {
+		return err
+	}
+	stored := &StoredToken{Token: *tok, Scopes: grantedScopes(tok, config.Scopes)}
+	if err := mailer.tokens.reset(stored); err != nil {
+		return err
+	}
+	mailer.Scopes = stored.GrantedScopes()
+	return nil
+}
+
+// grantedScopes returns the scopes the server granted with tok, which may be
+// fewer than requested when the user unticked some on the consent screen.
+func grantedScopes(tok *oauth2.Token, requested []string) []string {
+	if scope, ok := tok.Extra("scope").(string); ok && scope != "" {
+		return strings.Fields(scope)
+	}
+	return requested
+}
+
+// tokenInfo is what Google reports about an access token.
+type tokenInfo struct {
+	Scope string `json:"scope"`
+	Email string `json:"email"`
+}
+
+func fetchTokenInfo(accessToken string) (*tokenInfo, error) {
+	// Posted rather than put in the URL, where proxies and logs would see it.
+	resp, err := authClient.PostForm(tokenInfoURL, url.Values{"access_token": {accessToken}})
+	if err != nil {
+		return nil, err
+	}
+	info := &tokenInfo{}
+	if err := decodeJSON(resp, info); err != nil {
+		return nil, fmt.Errorf("unable to read token info: %v", err)
+	}
+	return info, nil
+}
+
+// AuthInfo describes the saved sign-in.
+type AuthInfo struct {
+	Account     string
+	Store       string
+	Scopes      []string
+	Expiry      time.Time
+	Refreshable bool
+}
+
+// SavedScopes returns the scopes granted to the account's saved token, so a
+// new sign-in can ask for the same access.
+func SavedScopes(account *Account) ([]string, error) {
+	store, err := account.OpenTokenStore()
+	if err != nil {
+		return nil, err
+	}
+	tok, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	return tok.GrantedScopes(), nil
+}
+
+// tokenInfoURL reports the scopes granted to an access token.
+const tokenInfoURL = "https://oauth2.googleapis.com/tokeninfo"
+
+// authClient makes the token info requests, which must not hang forever.
+var authClient = &http.Client{Timeout: 30 * time.Second}
+
+func decodeJSON(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// AuthStatus checks the saved sign-in, refreshing the access token if it
+// expired. It returns ErrReauthorize when the sign-in was revoked.
+func AuthStatus(creds []byte, account *Account) (*AuthInfo, error) {
+	// The scopes are those granted with the saved token, set by getClient.
+	config, err := google.ConfigFromJSON(creds)
+	if err != nil {
+		return nil, err
+	}
+	client, tokens, err := getClient(config, account)
+	if err != nil {
+		return nil, err
+	}
+	info := &AuthInfo{Store: tokens.store.String()}
+	tok, err := tokens.Token()
+	if err != nil {
+		return info, err
+	}
+	info.Expiry = tok.Expiry
+	info.Refreshable = tok.RefreshToken != ""
+
+	granted, err := fetchTokenInfo(tok.AccessToken)
+	if err != nil {
+		return info, err
+	}
+	info.Scopes = strings.Fields(granted.Scope)
+	if granted.Email != "" {
+		info.Account = granted.Email
+		return info, nil
+	}
+
+	srv, err := gmail.New(client)
+	if err != nil {
+		return info, err
+	}
+	profile, err := srv.Users.GetProfile("me").Do()
+	if err != nil {
+		return info, err
+	}
+	info.Account = profile.EmailAddress
+	return info, nil
+}
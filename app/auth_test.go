@@ -0,0 +1,56 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestSavingTokenSource(t *testing.T) {
+	revoke := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if revoke {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_grant","error_description":"Token has been expired or revoked."}`)
+			return
+		}
+		fmt.Fprint(w, `{"access_token":"fresh","token_type":"Bearer","expires_in":3600}`)
+	}))
+	defer server.Close()
+
+	store := &fileStore{path: filepath.Join(t.TempDir(), "token.json")}
+	config := &oauth2.Config{ClientID: "client", Endpoint: oauth2.Endpoint{TokenURL: server.URL}}
+	expired := &StoredToken{Token: oauth2.Token{AccessToken: "stale", RefreshToken: "refresh", Expiry: time.Now().Add(-time.Hour)}, Scopes: []string{"s"}}
+
+	src := newSavingTokenSource(config, store, expired)
+	tok, err := src.Token()
+	if err != nil || tok.AccessToken != "fresh" {
+		t.Fatalf("refresh: got %v, %v", tok, err)
+	}
+	saved, err := store.Load()
+	if err != nil || saved.AccessToken != "fresh" || len(saved.Scopes) != 1 {
+		t.Fatalf("refreshed token not saved with its scopes: %+v, %v", saved, err)
+	}
+
+	revoke = true
+	revoked := make(chan bool, 1)
+	src = newSavingTokenSource(config, store, expired)
+	src.onRevoke = func() { revoked <- true }
+	if _, err := src.Token(); !IsReauthRequired(err) {
+		t.Fatalf("expected ErrReauthorize, got %v", err)
+	}
+	select {
+	case <-revoked:
+	case <-time.After(time.Second):
+		t.Error("onRevoke not called")
+	}
+	if _, err := src.Token(); !IsReauthRequired(err) {
+		t.Errorf("expected ErrReauthorize again, got %v", err)
+	}
+}
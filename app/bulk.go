@@ -0,0 +1,183 @@
+package app
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// batchLimit is the maximum number of message IDs Gmail accepts per batch request.
+const batchLimit = 1000
+
+// BulkActions lists the actions the bulk engine can apply to messages.
+var BulkActions = []string{"read", "unread", "archive", "label", "trash", "delete"}
+
+// BulkJob is a bulk action over the messages matching a query. The matched
+// IDs are saved under bulk in the DataDir along with the progress, so an
+// interrupted job resumes where it stopped.
+type BulkJob struct {
+	Account string
+	Query   string
+	Action  string
+	Add     []string
+	Remove  []string
+	IDs     []string
+	Done    int
+	Created time.Time
+	Resumed bool `json:"-"`
+}
+
+// NewBulkJob lists the messages matching query, or resumes the unfinished
+// job for the same query and action. With restart a saved job is discarded.
+func (mailer *Mailer) NewBulkJob(query, action string, add, remove []string, restart bool) (*BulkJob, error) {
+	if !contains(BulkActions, action) {
+		return nil, fmt.Errorf("unknown bulk action %q, expected one of %s", action, strings.Join(BulkActions, "|"))
+	}
+	if action == "label" && len(add) == 0 && len(remove) == 0 {
+		return nil, fmt.Errorf("bulk label needs labels to add or remove (-add, -remove)")
+	}
+	if err := mailer.Require(actionCapability(action)); err != nil {
+		return nil, err
+	}
+	job := &BulkJob{Account: mailer.Account, Query: query, Action: action, Add: add, Remove: remove, Created: time.Now()}
+	if data, err := ioutil.ReadFile(job.path()); err == nil && !restart {
+		if err := json.Unmarshal(data, job); err != nil {
+			return nil, err
+		}
+		job.Resumed = true
+		return job, nil
+	}
+
+	ids, err := mailer.MatchingMessages(nil, query)
+	if err != nil {
+		return nil, err
+	}
+	job.IDs = ids
+	return job, job.save()
+}
+
+// RunBulk applies the job's action in batches, saving progress after each
+// batch and calling progress with the number of messages done so far.
+func (mailer *Mailer) RunBulk(job *BulkJob, progress func(done, total int)) error {
+	for job.Done < len(job.IDs) {
+		end := job.Done + batchLimit
+		if end > len(job.IDs) {
+			end = len(job.IDs)
+		}
+		if err := mailer.BatchApply(job.Action, job.IDs[job.Done:end], job.Add, job.Remove); err != nil {
+			return err
+		}
+		job.Done = end
+		if err := job.save(); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(job.Done, len(job.IDs))
+		}
+	}
+	return job.Discard()
+}
+
+// BatchApply applies a bulk action to the messages, in batches of at most 1000 IDs.
+func (mailer *Mailer) BatchApply(action string, ids []string, add, remove []string) error {
+	if err := mailer.Require(actionCapability(action)); err != nil {
+		return err
+	}
+	for start := 0; start < len(ids); start += batchLimit {
+		end := start + batchLimit
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batch := ids[start:end]
+		if action == "delete" {
+			if err := mailer.Service.Users.Messages.BatchDelete(mailer.User, &gmail.BatchDeleteMessagesRequest{Ids: batch}).Do(); err != nil {
+				return err
+			}
+			continue
+		}
+		modReq := &gmail.BatchModifyMessagesRequest{Ids: batch}
+		switch action {
+		case "read":
+			modReq.RemoveLabelIds = []string{"UNREAD"}
+		case "unread":
+			modReq.AddLabelIds = []string{"UNREAD"}
+		case "archive":
+			modReq.RemoveLabelIds = []string{"INBOX"}
+		case "trash":
+			modReq.AddLabelIds = []string{"TRASH"}
+		case "label":
+			modReq.AddLabelIds = add
+			modReq.RemoveLabelIds = remove
+		default:
+			return fmt.Errorf("unknown bulk action: %s", action)
+		}
+		if err := mailer.Service.Users.Messages.BatchModify(mailer.User, modReq).Do(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Discard removes the saved progress of the job.
+func (job *BulkJob) Discard() error {
+	err := os.Remove(job.path())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// ApplyToThreads applies a bulk action to every message of the threads in a
+// single batch request, keeping the threads' label IDs in step.
+func (mailer *Mailer) ApplyToThreads(action string, threads []*Thread, add, remove []string) error {
+	ids := make([]string, 0)
+	for _, thread := range threads {
+		for _, msg := range thread.Messages {
+			ids = append(ids, msg.ID)
+		}
+	}
+	if err := mailer.BatchApply(action, ids, add, remove); err != nil {
+		return err
+	}
+	if action == "label" {
+		for _, thread := range threads {
+			thread.updateLabels(add, remove)
+		}
+	}
+	return nil
+}
+
+func (job *BulkJob) path() string {
+	key := strings.Join([]string{job.Action, job.Query, strings.Join(job.Add, ","), strings.Join(job.Remove, ",")}, "|")
+	if !SameAccount(job.Account, DefaultAccount) {
+		key = job.Account + "|" + key
+	}
+	sum := sha1.Sum([]byte(key))
+	return dataPath("bulk", hex.EncodeToString(sum[:])[:12]+".json")
+}
+
+func (job *BulkJob) save() error {
+	if err := os.MkdirAll(dataPath("bulk"), 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(job.path(), data, 0600)
+}
+
+// actionCapability returns what the granted scopes must allow for a bulk action.
+func actionCapability(action string) Capability {
+	if action == "delete" {
+		return CapDelete
+	}
+	return CapModify
+}
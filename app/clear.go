@@ -0,0 +1,54 @@
+package app
+
+import (
+	"strings"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/gmail/v1"
+)
+
+// ClearOptions selects the messages removed by clear mode.
+type ClearOptions struct {
+	Labels []string
+	Query  string
+	// OlderThan is a Gmail age such as "30d", "6m" or "1y".
+	OlderThan string
+	// Permanent deletes messages instead of moving them to the trash.
+	Permanent bool
+}
+
+// SearchQuery combines the query and age filter into a Gmail search query.
+func (opts *ClearOptions) SearchQuery() string {
+	query := strings.TrimSpace(opts.Query)
+	if opts.OlderThan != "" {
+		query = strings.TrimSpace(query + " older_than:" + opts.OlderThan)
+	}
+	return query
+}
+
+// MatchingMessages returns the IDs of every message under the labels matching the query.
+func (mailer *Mailer) MatchingMessages(labels []string, query string) ([]string, error) {
+	ids := make([]string, 0)
+	call := mailer.Service.Users.Messages.List(mailer.User).MaxResults(500)
+	if len(labels) > 0 {
+		call = call.LabelIds(labels...)
+	}
+	if query != "" {
+		call = call.Q(query)
+	}
+	err := call.Pages(context.Background(), func(r *gmail.ListMessagesResponse) error {
+		for _, msg := range r.Messages {
+			ids = append(ids, msg.Id)
+		}
+		return nil
+	})
+	return ids, err
+}
+
+// ClearMessages moves the messages to the trash, or deletes them permanently.
+func (mailer *Mailer) ClearMessages(ids []string, permanent bool) error {
+	if permanent {
+		return mailer.BatchApply("delete", ids, nil, nil)
+	}
+	return mailer.BatchApply("trash", ids, nil, nil)
+}
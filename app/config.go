@@ -0,0 +1,141 @@
+package app
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/ajithnn/thanthi/logger"
+)
+
+// LegacyConfigDir is the directory, relative to the working directory, that
+// held all settings and state before the XDG directories were used. Its
+// files are moved to the XDG directories on first use.
+const LegacyConfigDir = "configs"
+
+// Config holds the optional user settings read from config.json in the ConfigDir.
+type Config struct {
+	// InternalDomains lists the domains treated as internal. When set, sending
+	// to any other domain asks for confirmation first.
+	InternalDomains []string `json:"internal_domains"`
+	// UndoSendSeconds is the grace period queued mail waits in the outbox (default 10).
+	UndoSendSeconds int `json:"undo_send_seconds"`
+	// TokenStore picks where the OAuth token is kept: keyring, encrypted or
+	// file. By default the keyring is used when available, else an encrypted file.
+	TokenStore string `json:"token_store"`
+	// Accounts lists further named accounts, picked with -account.
+	Accounts []*Account `json:"accounts"`
+	// DefaultAccount is the account used when none is picked.
+	DefaultAccount string `json:"default_account"`
+}
+
+// ConfigDir returns the settings directory, $XDG_CONFIG_HOME/thanthi or ~/.config/thanthi.
+func ConfigDir() string {
+	return xdgDir("XDG_CONFIG_HOME", ".config")
+}
+
+// DataDir returns the directory for tokens and local state, $XDG_DATA_HOME/thanthi
+// or ~/.local/share/thanthi.
+func DataDir() string {
+	return xdgDir("XDG_DATA_HOME", filepath.Join(".local", "share"))
+}
+
+func xdgDir(env, fallback string) string {
+	base := os.Getenv(env)
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return LegacyConfigDir
+		}
+		base = filepath.Join(home, fallback)
+	}
+	return filepath.Join(base, "thanthi")
+}
+
+// configPath returns the path of a settings file in the ConfigDir.
+func configPath(elem ...string) string {
+	migrateLegacyDir()
+	return filepath.Join(append([]string{ConfigDir()}, elem...)...)
+}
+
+// dataPath returns the path of a local state file in the DataDir.
+func dataPath(elem ...string) string {
+	migrateLegacyDir()
+	return filepath.Join(append([]string{DataDir()}, elem...)...)
+}
+
+// writeFile writes a private file, creating its directory if needed.
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// Files older versions kept in the LegacyConfigDir, by their new directory.
+// The token is moved by OpenTokenStore and credentials.json stays for packr.
+var (
+	legacyConfigFiles = []string{"config.json", "rules.yml", "signature.md", "signatures"}
+	legacyDataFiles   = []string{"contacts.json", "threads.json", "rules.json", "outbox", "bulk"}
+)
+
+var legacyOnce sync.Once
+
+// migrateLegacyDir moves the files of older versions from the LegacyConfigDir
+// in the working directory to the XDG directories, once per run. Only a
+// directory holding thanthi state is taken to be one of ours, so another
+// project's configs directory is left alone.
+func migrateLegacyDir() {
+	legacyOnce.Do(func() {
+		ours := false
+		for _, name := range append([]string{"token.json"}, legacyDataFiles...) {
+			if _, err := os.Stat(filepath.Join(LegacyConfigDir, name)); err == nil {
+				ours = true
+			}
+		}
+		if !ours {
+			return
+		}
+		moveLegacyFiles(legacyConfigFiles, ConfigDir())
+		moveLegacyFiles(legacyDataFiles, DataDir())
+	})
+}
+
+func moveLegacyFiles(names []string, dir string) {
+	for _, name := range names {
+		from := filepath.Join(LegacyConfigDir, name)
+		if _, err := os.Stat(from); err != nil {
+			continue
+		}
+		to := filepath.Join(dir, name)
+		if _, err := os.Stat(to); err == nil {
+			logger.NewLogger().Infof("MigrateLegacyDir: Left %s, %s already exists", from, to)
+			continue
+		}
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			logger.NewLogger().Infof("MigrateLegacyDir: %v", err)
+			return
+		}
+		if err := os.Rename(from, to); err != nil {
+			logger.NewLogger().Infof("MigrateLegacyDir: Unable to move %s: %v", from, err)
+			continue
+		}
+		logger.NewLogger().Infof("MigrateLegacyDir: Moved %s to %s", from, to)
+	}
+}
+
+// LoadConfig reads config.json, returning defaults if it does not exist.
+func LoadConfig() (*Config, error) {
+	config := &Config{}
+	data, err := ioutil.ReadFile(configPath("config.json"))
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+	err = json.Unmarshal(data, config)
+	return config, err
+}
@@ -0,0 +1,234 @@
+package app
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/mail"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// harvestWindow bounds how old harvested mail may be. Older mail adds little
+// to a score that halves every 30 days, so its IDs are not kept.
+const harvestWindow = 90 * 24 * time.Hour
+
+// Contact is an address seen in fetched mail or imported from an address book.
+type Contact struct {
+	Name     string
+	Address  string
+	Count    int
+	LastSeen time.Time
+}
+
+// Contacts is the local address book of an account, kept in contacts.json.
+type Contacts struct {
+	Entries map[string]*Contact
+	// Harvested maps the Gmail message IDs already counted to their date, so
+	// reloading a page does not inflate counts.
+	Harvested map[string]time.Time
+	path      string
+}
+
+func (c *Contact) String() string {
+	return (&mail.Address{Name: c.Name, Address: c.Address}).String()
+}
+
+// Score weights how often an address was seen by how recently, halving every 30 days.
+func (c *Contact) Score(now time.Time) float64 {
+	age := now.Sub(c.LastSeen).Hours() / 24
+	if age < 0 {
+		age = 0
+	}
+	return float64(c.Count) * math.Pow(0.5, age/30)
+}
+
+// LoadContacts reads the address book of the account, starting an empty one if none exists yet.
+func LoadContacts(account string) (*Contacts, error) {
+	contacts := &Contacts{
+		Entries:   make(map[string]*Contact),
+		Harvested: make(map[string]time.Time),
+		path:      accountDataPath(account, "contacts.json"),
+	}
+	data, err := ioutil.ReadFile(contacts.path)
+	if os.IsNotExist(err) {
+		return contacts, nil
+	}
+	if err != nil {
+		return contacts, err
+	}
+	err = json.Unmarshal(data, contacts)
+	if contacts.Harvested == nil {
+		contacts.Harvested = make(map[string]time.Time)
+	}
+	contacts.prune(time.Now())
+	return contacts, err
+}
+
+// prune forgets the harvested IDs of mail older than the harvestWindow.
+func (contacts *Contacts) prune(now time.Time) {
+	for id, seen := range contacts.Harvested {
+		if now.Sub(seen) > harvestWindow {
+			delete(contacts.Harvested, id)
+		}
+	}
+}
+
+func (contacts *Contacts) Save() error {
+	data, err := json.MarshalIndent(contacts, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(contacts.path, data)
+}
+
+// Add records an address seen at the given time, keeping the most recent display name.
+func (contacts *Contacts) Add(name, address string, seen time.Time) {
+	key := strings.ToLower(strings.TrimSpace(address))
+	if key == "" {
+		return
+	}
+	contact, ok := contacts.Entries[key]
+	if !ok {
+		contact = &Contact{Address: key}
+		contacts.Entries[key] = contact
+	}
+	contact.Count++
+	if seen.After(contact.LastSeen) {
+		contact.LastSeen = seen
+		if name != "" {
+			contact.Name = name
+		}
+	} else if contact.Name == "" {
+		contact.Name = name
+	}
+}
+
+// HarvestMessage adds the addresses of the given headers once per Gmail
+// message ID. Mail older than the harvestWindow is skipped, as its ID would
+// not be kept to stop it being counted again.
+func (contacts *Contacts) HarvestMessage(id string, seen time.Time, headers ...string) {
+	if _, ok := contacts.Harvested[id]; ok || time.Since(seen) > harvestWindow {
+		return
+	}
+	contacts.Harvested[id] = seen
+	for _, header := range headers {
+		contacts.Harvest(header, seen)
+	}
+}
+
+// Harvest adds every address of an address list header such as From, To or Cc.
+func (contacts *Contacts) Harvest(header string, seen time.Time) {
+	if strings.TrimSpace(header) == "" {
+		return
+	}
+	addresses, err := mail.ParseAddressList(header)
+	if err != nil {
+		return
+	}
+	for _, address := range addresses {
+		contacts.Add(address.Name, address.Address, seen)
+	}
+}
+
+// Search returns contacts whose name or address contains query, best scored first.
+func (contacts *Contacts) Search(query string, limit int) []*Contact {
+	now := time.Now()
+	query = strings.ToLower(strings.TrimSpace(query))
+	matches := make([]*Contact, 0)
+	for _, contact := range contacts.Entries {
+		if strings.Contains(contact.Address, query) || strings.Contains(strings.ToLower(contact.Name), query) {
+			matches = append(matches, contact)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Score(now) > matches[j].Score(now)
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// Import reads contacts from a vCard (.vcf) or CSV file.
+func (contacts *Contacts) Import(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if strings.HasSuffix(strings.ToLower(path), ".csv") {
+		return contacts.importCSV(f)
+	}
+	return contacts.importVCard(f)
+}
+
+func (contacts *Contacts) importVCard(r io.Reader) (int, error) {
+	var name string
+	var addresses []string
+	count := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		sep := strings.Index(line, ":")
+		if sep < 0 {
+			continue
+		}
+		key := strings.ToUpper(strings.Split(line[:sep], ";")[0])
+		value := line[sep+1:]
+		switch key {
+		case "BEGIN":
+			name, addresses = "", nil
+		case "FN":
+			name = value
+		case "EMAIL":
+			addresses = append(addresses, value)
+		case "END":
+			for _, address := range addresses {
+				contacts.Add(name, address, time.Time{})
+				count++
+			}
+		}
+	}
+	return count, scanner.Err()
+}
+
+// importCSV expects a header row, using the first column mentioning "mail"
+// for the address and the first mentioning "name" for the display name.
+func (contacts *Contacts) importCSV(r io.Reader) (int, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil || len(records) == 0 {
+		return 0, err
+	}
+	nameCol, mailCol := -1, -1
+	for index, column := range records[0] {
+		column = strings.ToLower(column)
+		if mailCol < 0 && strings.Contains(column, "mail") {
+			mailCol = index
+		} else if nameCol < 0 && strings.Contains(column, "name") {
+			nameCol = index
+		}
+	}
+	if mailCol < 0 {
+		return 0, errors.New("csv file has no email column")
+	}
+	count := 0
+	for _, record := range records[1:] {
+		if mailCol >= len(record) {
+			continue
+		}
+		var name string
+		if nameCol >= 0 && nameCol < len(record) {
+			name = record[nameCol]
+		}
+		contacts.Add(name, record[mailCol], time.Time{})
+		count++
+	}
+	return count, nil
+}
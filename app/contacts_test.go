@@ -0,0 +1,107 @@
+package app
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestContactsSearch(t *testing.T) {
+	now := time.Now()
+	contacts := &Contacts{Entries: make(map[string]*Contact), Harvested: make(map[string]time.Time)}
+	contacts.Add("Ann Lee", "ann@example.com", now)
+	contacts.Add("Ann Lee", "ann@example.com", now)
+	contacts.Add("Annette", "annette@example.com", now)
+	contacts.Add("Old Ann", "ann@old.example.com", now.AddDate(0, -6, 0))
+	contacts.Add("Old Ann", "ann@old.example.com", now.AddDate(0, -6, 0))
+	contacts.Add("Old Ann", "ann@old.example.com", now.AddDate(0, -6, 0))
+	contacts.Add("Bob", "bob@example.com", now)
+
+	tests := []struct {
+		query    string
+		limit    int
+		expected []string
+	}{
+		{"ann", 0, []string{"ann@example.com", "annette@example.com", "ann@old.example.com"}},
+		{"ANN", 2, []string{"ann@example.com", "annette@example.com"}},
+		{"lee", 0, []string{"ann@example.com"}},
+		{"carol", 0, []string{}},
+	}
+	for _, test := range tests {
+		matches := contacts.Search(test.query, test.limit)
+		addresses := make([]string, 0, len(matches))
+		for _, match := range matches {
+			addresses = append(addresses, match.Address)
+		}
+		if strings.Join(addresses, ",") != strings.Join(test.expected, ",") {
+			t.Errorf("Search(%q, %d) = %v, expected %v", test.query, test.limit, addresses, test.expected)
+		}
+	}
+}
+
+func TestContactsHarvestMessage(t *testing.T) {
+	now := time.Now()
+	contacts := &Contacts{Entries: make(map[string]*Contact), Harvested: make(map[string]time.Time)}
+	contacts.HarvestMessage("1", now, "Ann <ann@example.com>", "bob@example.com, Carol <carol@example.com>")
+	contacts.HarvestMessage("1", now, "Ann <ann@example.com>")
+	contacts.HarvestMessage("2", now.Add(-2*harvestWindow), "Ann <ann@example.com>")
+	if count := contacts.Entries["ann@example.com"].Count; count != 1 {
+		t.Errorf("ann counted %d times, expected once", count)
+	}
+	if len(contacts.Entries) != 3 {
+		t.Errorf("harvested %d contacts, expected 3", len(contacts.Entries))
+	}
+	contacts.Harvested["3"] = now.Add(-2 * harvestWindow)
+	contacts.prune(now)
+	if _, ok := contacts.Harvested["3"]; ok || len(contacts.Harvested) != 1 {
+		t.Errorf("prune kept %v, expected only recent mail", contacts.Harvested)
+	}
+}
+
+func TestContactsImport(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		file     string
+		data     string
+		count    int
+		expected map[string]string
+		wantErr  bool
+	}{
+		{
+			file: "contacts.vcf",
+			data: "BEGIN:VCARD\r\nVERSION:3.0\r\nFN:Ann Lee\r\nEMAIL;TYPE=work:Ann@Example.com\r\nEMAIL:ann@home.example.com\r\nEND:VCARD\r\n" +
+				"BEGIN:VCARD\r\nFN:Bob\r\nEND:VCARD\r\nBEGIN:VCARD\r\nEMAIL:carol@example.com\r\nEND:VCARD\r\n",
+			count:    3,
+			expected: map[string]string{"ann@example.com": "Ann Lee", "ann@home.example.com": "Ann Lee", "carol@example.com": ""},
+		},
+		{
+			file:     "contacts.csv",
+			data:     "First Name,E-mail Address,Phone\nAnn,ann@example.com,1\nBob,bob@example.com,2\n,carol@example.com,3\n",
+			count:    3,
+			expected: map[string]string{"ann@example.com": "Ann", "bob@example.com": "Bob", "carol@example.com": ""},
+		},
+		{file: "nomail.csv", data: "Name,Phone\nAnn,1\n", wantErr: true},
+	}
+	for _, test := range tests {
+		path := filepath.Join(dir, test.file)
+		if err := ioutil.WriteFile(path, []byte(test.data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		contacts := &Contacts{Entries: make(map[string]*Contact), Harvested: make(map[string]time.Time)}
+		count, err := contacts.Import(path)
+		if (err != nil) != test.wantErr {
+			t.Errorf("Import(%s) error = %v, wantErr %v", test.file, err, test.wantErr)
+			continue
+		}
+		if count != test.count || len(contacts.Entries) != len(test.expected) {
+			t.Errorf("Import(%s) = %d contacts %v, expected %d", test.file, count, contacts.Entries, test.count)
+		}
+		for address, name := range test.expected {
+			if contact, ok := contacts.Entries[address]; !ok || contact.Name != name {
+				t.Errorf("Import(%s): %s = %+v, expected name %q", test.file, address, contact, name)
+			}
+		}
+	}
+}
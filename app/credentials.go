@@ -0,0 +1,92 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// CredentialsEnv names an OAuth client credentials file, used when no path is given.
+const CredentialsEnv = "THANTHI_CREDENTIALS"
+
+// oauthClient is the part of a Google OAuth client file thanthi needs.
+type oauthClient struct {
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	AuthURI      string `json:"auth_uri"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// LoadCredentials reads the OAuth client credentials from path, else the file
+// named by THANTHI_CREDENTIALS, else credentials.json in the ConfigDir, else
+// the fallback, e.g. credentials embedded at build time. It returns them
+// along with where they came from.
+func LoadCredentials(path string, fallback func() ([]byte, error)) ([]byte, string, error) {
+	if path == "" {
+		path = os.Getenv(CredentialsEnv)
+	}
+	if path == "" {
+		if _, err := os.Stat(configPath("credentials.json")); err == nil {
+			path = configPath("credentials.json")
+		}
+	}
+	if path == "" {
+		if fallback != nil {
+			if data, err := fallback(); err == nil {
+				if err := ValidateCredentials(data); err != nil {
+					return nil, "built-in credentials", fmt.Errorf("built-in credentials: %v", err)
+				}
+				return data, "built-in credentials", nil
+			}
+		}
+		return nil, "", fmt.Errorf("no OAuth client credentials: pass -credentials, set %s or save the client file from the Google Cloud console as %s", CredentialsEnv, configPath("credentials.json"))
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, path, err
+	}
+	if err := ValidateCredentials(data); err != nil {
+		return nil, path, fmt.Errorf("%s: %v", path, err)
+	}
+	return data, path, nil
+}
+
+// ValidateCredentials checks that data is a Google OAuth client file for a desktop app.
+func ValidateCredentials(data []byte) error {
+	file := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("not a JSON credentials file: %v", err)
+	}
+	if _, ok := file["type"]; ok {
+		return fmt.Errorf("this is a service account key, download an OAuth client ID of type Desktop app instead")
+	}
+	if _, ok := file["web"]; ok {
+		return fmt.Errorf("this is a Web application client, create an OAuth client ID of type Desktop app instead")
+	}
+	raw, ok := file["installed"]
+	if !ok {
+		return fmt.Errorf("missing the \"installed\" section of an OAuth client ID of type Desktop app")
+	}
+	client := &oauthClient{}
+	if err := json.Unmarshal(raw, client); err != nil {
+		return fmt.Errorf("invalid \"installed\" section: %v", err)
+	}
+	missing := make([]string, 0)
+	fields := []struct{ name, value string }{
+		{"client_id", client.ClientID},
+		{"client_secret", client.ClientSecret},
+		{"auth_uri", client.AuthURI},
+		{"token_uri", client.TokenURI},
+	}
+	for _, field := range fields {
+		if field.value == "" {
+			missing = append(missing, field.name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing %s in the \"installed\" section", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package app
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateCredentials(t *testing.T) {
+	tests := []struct {
+		name string
+		json string
+		err  string
+	}{
+		{"desktop client", `{"installed":{"client_id":"id","client_secret":"secret","auth_uri":"https://a","token_uri":"https://t"}}`, ""},
+		{"not json", `client_id=id`, "not a JSON"},
+		{"service account", `{"type":"service_account","client_email":"x@y"}`, "service account"},
+		{"web client", `{"web":{"client_id":"id"}}`, "Web application"},
+		{"no installed", `{}`, "missing the \"installed\""},
+		{"missing fields", `{"installed":{"client_id":"id","auth_uri":"https://a"}}`, "missing client_secret, token_uri"},
+	}
+	for _, test := range tests {
+		err := ValidateCredentials([]byte(test.json))
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", test.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected an error with %q, got %v", test.name, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ajithnn/thanthi/logger"
+)
+
+// RunDueTasks delivers due outbox mail, returns expired snoozes to the inbox
+// and re-archives muted threads. It runs on launch and in the daemon. Tasks
+// the granted scopes do not allow are skipped.
+func (mailer *Mailer) RunDueTasks() error {
+	var sent, restored, muted int
+	var err error
+	if mailer.Can(CapSend) {
+		if sent, err = mailer.FlushOutbox(false); err != nil {
+			return err
+		}
+	}
+	if mailer.Can(CapModify) {
+		if restored, err = mailer.ProcessSnoozes(); err != nil {
+			return err
+		}
+		if muted, err = mailer.ApplyMutes(); err != nil {
+			return err
+		}
+	}
+	if sent > 0 || restored > 0 || muted > 0 {
+		logger.NewLogger().Infof("Mailer#RunDueTasks: Sent %d mail(s), unsnoozed %d thread(s), archived %d muted thread(s)", sent, restored, muted)
+	}
+	return nil
+}
+
+// RunDaemon runs the due tasks as they become due and applies the rules to
+// new mail, checking at least once per interval, until the process is
+// stopped. Failures are logged and retried.
+// Only one daemon runs per account; it returns an error if another holds the lock.
+func (mailer *Mailer) RunDaemon(interval time.Duration) error {
+	unlock, err := lockDaemon(mailer.Account)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	for {
+		if err := mailer.RunDueTasks(); err != nil {
+			logger.NewLogger().Infof("Mailer#RunDaemon: %v", err)
+		}
+		if mailer.Can(CapRead) {
+			if checked, err := mailer.ProcessRules(); err != nil {
+				logger.NewLogger().Infof("Mailer#RunDaemon: Rules failed: %v", err)
+			} else if checked > 0 {
+				logger.NewLogger().Infof("Mailer#RunDaemon: Ran rules on %d thread(s)", checked)
+			}
+		}
+
+		wait := interval
+		if next, ok := NextOutboxDue(mailer.Account); ok && time.Until(next) < wait {
+			wait = time.Until(next)
+		}
+		if wait < time.Second {
+			wait = time.Second
+		}
+		time.Sleep(wait)
+	}
+}
+
+// lockDaemon writes a pidfile for the account's daemon in the DataDir,
+// taking over a pidfile left by a daemon that is no longer running.
+func lockDaemon(account string) (func(), error) {
+	if account == "" {
+		account = DefaultAccount
+	}
+	path := dataPath("daemon-" + account + ".pid")
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			fmt.Fprintf(file, "%d\n", os.Getpid())
+			file.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if pid := readPid(path); pid > 0 && processRunning(pid) {
+			return nil, fmt.Errorf("a daemon for account %s is already running with pid %d", account, pid)
+		}
+		os.Remove(path)
+	}
+	return nil, fmt.Errorf("unable to lock %s", path)
+}
+
+func readPid(path string) int {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid
+}
+
+func processRunning(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	// EPERM means the process exists but belongs to another user.
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
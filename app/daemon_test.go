@@ -0,0 +1,61 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestLockDaemon(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	release, err := lockDaemon("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lockDaemon("work"); err == nil {
+		t.Error("locked the daemon of an account twice")
+	}
+	other, err := lockDaemon("personal")
+	if err != nil {
+		t.Errorf("the lock of one account blocked another: %v", err)
+	} else {
+		other()
+	}
+	release()
+	again, err := lockDaemon("work")
+	if err != nil {
+		t.Fatalf("lock not released: %v", err)
+	}
+	again()
+}
+
+func TestLockDaemonStalePidfile(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	exited := exec.Command("true")
+	if err := exited.Run(); err != nil {
+		t.Skip("no true command:", err)
+	}
+	path := dataPath("daemon-work.pid")
+	if err := writeFile(path, []byte(fmt.Sprintf("%d\n", exited.Process.Pid))); err != nil {
+		t.Fatal(err)
+	}
+	release, err := lockDaemon("work")
+	if err != nil {
+		t.Fatalf("stale pidfile not taken over: %v", err)
+	}
+	defer release()
+	if pid := readPid(path); pid != os.Getpid() {
+		t.Errorf("pidfile holds %d, expected %d", pid, os.Getpid())
+	}
+}
+
+func TestProcessRunning(t *testing.T) {
+	if !processRunning(os.Getpid()) {
+		t.Error("own process not running")
+	}
+	// Init belongs to root, so this checks EPERM counts as running for other users.
+	if !processRunning(1) {
+		t.Error("init not running")
+	}
+}
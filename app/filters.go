@@ -0,0 +1,290 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/gmail/v1"
+	"gopkg.in/yaml.v2"
+)
+
+// FilterSpec is a Gmail server-side filter with labels referred to by name,
+// as written in filter YAML files and on the command line.
+type FilterSpec struct {
+	ID            string   `yaml:"id,omitempty" json:"id,omitempty"`
+	From          string   `yaml:"from,omitempty" json:"from,omitempty"`
+	To            string   `yaml:"to,omitempty" json:"to,omitempty"`
+	Subject       string   `yaml:"subject,omitempty" json:"subject,omitempty"`
+	Query         string   `yaml:"query,omitempty" json:"query,omitempty"`
+	NegatedQuery  string   `yaml:"negated_query,omitempty" json:"negated_query,omitempty"`
+	HasAttachment bool     `yaml:"has_attachment,omitempty" json:"has_attachment,omitempty"`
+	Size          string   `yaml:"size,omitempty" json:"size,omitempty"`
+	AddLabels     []string `yaml:"add_labels,omitempty" json:"add_labels,omitempty"`
+	RemoveLabels  []string `yaml:"remove_labels,omitempty" json:"remove_labels,omitempty"`
+	Forward       string   `yaml:"forward,omitempty" json:"forward,omitempty"`
+}
+
+// FilterFile is the layout of a filters YAML file.
+type FilterFile struct {
+	Filters []*FilterSpec `yaml:"filters"`
+}
+
+// LoadFilterSpecs reads the filters listed in a YAML file.
+func LoadFilterSpecs(path string) ([]*FilterSpec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseFilterSpecs(data)
+}
+
+// ParseFilterSpecs parses filters YAML, either a FilterFile or a single filter.
+// YAML without any filter is an error.
+func ParseFilterSpecs(data []byte) ([]*FilterSpec, error) {
+	file := &FilterFile{}
+	if err := yaml.UnmarshalStrict(data, file); err == nil {
+		specs := make([]*FilterSpec, 0, len(file.Filters))
+		for _, spec := range file.Filters {
+			if spec != nil {
+				specs = append(specs, spec)
+			}
+		}
+		if len(specs) == 0 {
+			return nil, fmt.Errorf("no filters found")
+		}
+		return specs, nil
+	}
+	spec := &FilterSpec{}
+	if err := yaml.UnmarshalStrict(data, spec); err != nil {
+		return nil, err
+	}
+	return []*FilterSpec{spec}, nil
+}
+
+// FilterFromMessage pre-fills a filter matching mail from the message's sender.
+func FilterFromMessage(msg *Message, subject string) *FilterSpec {
+	spec := &FilterSpec{From: msg.From, Subject: subject}
+	if address, err := mail.ParseAddress(msg.From); err == nil {
+		spec.From = address.Address
+	}
+	return spec
+}
+
+// ListFilters returns the account's filters.
+func (mailer *Mailer) ListFilters() ([]*FilterSpec, error) {
+	resp, err := mailer.Service.Users.Settings.Filters.List(mailer.User).Do()
+	if err != nil {
+		return nil, err
+	}
+	specs := make([]*FilterSpec, 0)
+	for _, filter := range resp.Filter {
+		spec, err := mailer.filterSpec(filter)
+		if err != nil {
+			return specs, err
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// CreateFilter creates the filter, returning it with its new ID.
+func (mailer *Mailer) CreateFilter(spec *FilterSpec) (*FilterSpec, error) {
+	if err := mailer.Require(CapSettings); err != nil {
+		return nil, err
+	}
+	filter, err := mailer.gmailFilter(spec)
+	if err != nil {
+		return nil, err
+	}
+	created, err := mailer.Service.Users.Settings.Filters.Create(mailer.User, filter).Do()
+	if err != nil {
+		return nil, err
+	}
+	return mailer.filterSpec(created)
+}
+
+// DeleteFilter deletes the filter with the given ID.
+func (mailer *Mailer) DeleteFilter(id string) error {
+	if err := mailer.Require(CapSettings); err != nil {
+		return err
+	}
+	return mailer.Service.Users.Settings.Filters.Delete(mailer.User, id).Do()
+}
+
+func (mailer *Mailer) gmailFilter(spec *FilterSpec) (*gmail.Filter, error) {
+	criteria := &gmail.FilterCriteria{
+		From:          spec.From,
+		To:            spec.To,
+		Subject:       spec.Subject,
+		Query:         spec.Query,
+		NegatedQuery:  spec.NegatedQuery,
+		HasAttachment: spec.HasAttachment,
+	}
+	if spec.Size != "" {
+		comparison, size, err := parseFilterSize(spec.Size)
+		if err != nil {
+			return nil, err
+		}
+		criteria.SizeComparison = comparison
+		criteria.Size = size
+	}
+	if criteria.From == "" && criteria.To == "" && criteria.Subject == "" && criteria.Query == "" &&
+		criteria.NegatedQuery == "" && !criteria.HasAttachment && criteria.Size == 0 {
+		return nil, fmt.Errorf("filter needs at least one criterion")
+	}
+
+	add, err := mailer.LabelIDs(spec.AddLabels)
+	if err != nil {
+		return nil, err
+	}
+	remove, err := mailer.LabelIDs(spec.RemoveLabels)
+	if err != nil {
+		return nil, err
+	}
+	if len(add) == 0 && len(remove) == 0 && spec.Forward == "" {
+		return nil, fmt.Errorf("filter needs at least one action")
+	}
+	return &gmail.Filter{
+		Criteria: criteria,
+		Action:   &gmail.FilterAction{AddLabelIds: add, RemoveLabelIds: remove, Forward: spec.Forward},
+	}, nil
+}
+
+func (mailer *Mailer) filterSpec(filter *gmail.Filter) (*FilterSpec, error) {
+	spec := &FilterSpec{ID: filter.Id}
+	if c := filter.Criteria; c != nil {
+		spec.From, spec.To, spec.Subject = c.From, c.To, c.Subject
+		spec.Query, spec.NegatedQuery, spec.HasAttachment = c.Query, c.NegatedQuery, c.HasAttachment
+		if c.Size > 0 {
+			spec.Size = formatFilterSize(c.SizeComparison, c.Size)
+		}
+	}
+	if a := filter.Action; a != nil {
+		var err error
+		if spec.AddLabels, err = mailer.labelNames(a.AddLabelIds); err != nil {
+			return spec, err
+		}
+		if spec.RemoveLabels, err = mailer.labelNames(a.RemoveLabelIds); err != nil {
+			return spec, err
+		}
+		spec.Forward = a.Forward
+	}
+	return spec, nil
+}
+
+func (mailer *Mailer) labelNames(ids []string) ([]string, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	labels, err := mailer.FetchLabels()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0)
+	for _, id := range ids {
+		name := id
+		for _, label := range labels {
+			if label.Id == id {
+				name = label.Name
+			}
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// parseFilterSize parses sizes such as ">5M" or "<100K" into a Gmail size comparison.
+func parseFilterSize(value string) (string, int64, error) {
+	value = strings.TrimSpace(value)
+	comparison := "larger"
+	switch {
+	case strings.HasPrefix(value, ">"):
+		value = value[1:]
+	case strings.HasPrefix(value, "<"):
+		comparison = "smaller"
+		value = value[1:]
+	}
+	if value == "" {
+		return "", 0, fmt.Errorf("invalid size, expected e.g. >5M or <100K")
+	}
+	multiplier := int64(1)
+	switch strings.ToUpper(value[len(value)-1:]) {
+	case "K":
+		multiplier = 1 << 10
+	case "M":
+		multiplier = 1 << 20
+	}
+	if multiplier > 1 {
+		value = value[:len(value)-1]
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid size %q, expected e.g. >5M or <100K", value)
+	}
+	return comparison, size * multiplier, nil
+}
+
+func formatFilterSize(comparison string, size int64) string {
+	prefix := ">"
+	if comparison == "smaller" {
+		prefix = "<"
+	}
+	switch {
+	case size%(1<<20) == 0:
+		return fmt.Sprintf("%s%dM", prefix, size>>20)
+	case size%(1<<10) == 0:
+		return fmt.Sprintf("%s%dK", prefix, size>>10)
+	}
+	return fmt.Sprintf("%s%d", prefix, size)
+}
+
+// Summary returns the filter's criteria and actions as short text for listings.
+func (spec *FilterSpec) Summary() (string, string) {
+	criteria := make([]string, 0)
+	for _, field := range []struct{ name, value string }{
+		{"from", spec.From}, {"to", spec.To}, {"subject", spec.Subject},
+		{"query", spec.Query}, {"-query", spec.NegatedQuery}, {"size", spec.Size},
+	} {
+		if field.value != "" {
+			criteria = append(criteria, field.name+":"+field.value)
+		}
+	}
+	if spec.HasAttachment {
+		criteria = append(criteria, "has:attachment")
+	}
+	actions := make([]string, 0)
+	for _, label := range spec.AddLabels {
+		actions = append(actions, "+"+label)
+	}
+	for _, label := range spec.RemoveLabels {
+		actions = append(actions, "-"+label)
+	}
+	if spec.Forward != "" {
+		actions = append(actions, "forward:"+spec.Forward)
+	}
+	return strings.Join(criteria, " "), strings.Join(actions, " ")
+}
+
+// Template renders the filter as an editable YAML form listing every field.
+func (spec *FilterSpec) Template() string {
+	list := func(values []string) string {
+		quoted := make([]string, 0)
+		for _, value := range values {
+			quoted = append(quoted, strconv.Quote(value))
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	}
+	return "from: " + strconv.Quote(spec.From) + "\n" +
+		"to: " + strconv.Quote(spec.To) + "\n" +
+		"subject: " + strconv.Quote(spec.Subject) + "\n" +
+		"query: " + strconv.Quote(spec.Query) + "\n" +
+		"negated_query: " + strconv.Quote(spec.NegatedQuery) + "\n" +
+		"has_attachment: " + strconv.FormatBool(spec.HasAttachment) + "\n" +
+		"size: " + strconv.Quote(spec.Size) + "\n" +
+		"add_labels: " + list(spec.AddLabels) + "\n" +
+		"remove_labels: " + list(spec.RemoveLabels) + "\n" +
+		"forward: " + strconv.Quote(spec.Forward) + "\n"
+}
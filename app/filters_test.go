@@ -0,0 +1,30 @@
+package app
+
+import "testing"
+
+func TestParseFilterSpecs(t *testing.T) {
+	tests := []struct {
+		name  string
+		yaml  string
+		count int
+		valid bool
+	}{
+		{"single filter", "from: a@example.com\nadd_labels: [Work]\n", 1, true},
+		{"filter file", "filters:\n  - from: a@example.com\n  - subject: hello\n    forward: b@example.com\n", 2, true},
+		{"empty", "", 0, false},
+		{"comments only", "# from: a@example.com\n", 0, false},
+		{"empty list", "filters: []\n", 0, false},
+		{"unknown field", "frm: a@example.com\n", 0, false},
+		{"not yaml", "from: [a\n", 0, false},
+	}
+	for _, test := range tests {
+		specs, err := ParseFilterSpecs([]byte(test.yaml))
+		if (err == nil) != test.valid {
+			t.Errorf("%s: error = %v, expected valid %v", test.name, err, test.valid)
+			continue
+		}
+		if len(specs) != test.count {
+			t.Errorf("%s: parsed %d filter(s), expected %d", test.name, len(specs), test.count)
+		}
+	}
+}
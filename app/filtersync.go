@@ -0,0 +1,116 @@
+package app
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/gmail/v1"
+	"gopkg.in/yaml.v2"
+)
+
+// FilterPlan is the set of changes bringing the account's filters in line
+// with a filters file. Gmail filters are immutable, so a changed filter shows
+// up as a deletion of the old one and a creation of the new one.
+type FilterPlan struct {
+	Create    []*FilterSpec
+	Delete    []*FilterSpec
+	Unchanged int
+}
+
+// Empty reports whether the plan changes nothing.
+func (plan *FilterPlan) Empty() bool {
+	return len(plan.Create) == 0 && len(plan.Delete) == 0
+}
+
+// PlanFilterSync diffs the desired filters against the account's filters.
+func (mailer *Mailer) PlanFilterSync(desired []*FilterSpec) (*FilterPlan, error) {
+	resp, err := mailer.Service.Users.Settings.Filters.List(mailer.User).Do()
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]*gmail.Filter)
+	for _, filter := range resp.Filter {
+		current[filterKey(filter)] = filter
+	}
+
+	plan := &FilterPlan{}
+	wanted := make(map[string]bool)
+	for _, spec := range desired {
+		filter, err := mailer.gmailFilter(spec)
+		if err != nil {
+			return nil, err
+		}
+		key := filterKey(filter)
+		if wanted[key] {
+			continue
+		}
+		wanted[key] = true
+		if _, ok := current[key]; ok {
+			plan.Unchanged++
+			continue
+		}
+		plan.Create = append(plan.Create, spec)
+	}
+	for _, filter := range resp.Filter {
+		if wanted[filterKey(filter)] {
+			continue
+		}
+		spec, err := mailer.filterSpec(filter)
+		if err != nil {
+			return nil, err
+		}
+		plan.Delete = append(plan.Delete, spec)
+	}
+	return plan, nil
+}
+
+// ApplyFilterPlan creates the new filters before deleting the stale ones, so
+// a failure part way never leaves mail unfiltered.
+func (mailer *Mailer) ApplyFilterPlan(plan *FilterPlan) error {
+	for _, spec := range plan.Create {
+		if _, err := mailer.CreateFilter(spec); err != nil {
+			return err
+		}
+	}
+	for _, spec := range plan.Delete {
+		if err := mailer.DeleteFilter(spec.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportFilters writes the account's filters as a filters YAML file.
+func (mailer *Mailer) ExportFilters(path string) error {
+	specs, err := mailer.ListFilters()
+	if err != nil {
+		return err
+	}
+	for _, spec := range specs {
+		spec.ID = ""
+	}
+	data, err := yaml.Marshal(&FilterFile{Filters: specs})
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// filterKey identifies a filter by its criteria and actions, ignoring its ID and label order.
+func filterKey(filter *gmail.Filter) string {
+	key := make([]string, 0)
+	if c := filter.Criteria; c != nil {
+		key = append(key, strings.ToLower(c.From), strings.ToLower(c.To), c.Subject, c.Query, c.NegatedQuery,
+			fmt.Sprint(c.HasAttachment), c.SizeComparison, fmt.Sprint(c.Size))
+	}
+	if a := filter.Action; a != nil {
+		add := append([]string{}, a.AddLabelIds...)
+		remove := append([]string{}, a.RemoveLabelIds...)
+		sort.Strings(add)
+		sort.Strings(remove)
+		key = append(key, strings.Join(add, ","), strings.Join(remove, ","), strings.ToLower(a.Forward))
+	}
+	return strings.Join(key, "\x00")
+}
@@ -0,0 +1,336 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// FetchLabels returns the account's labels sorted by name, caching them for later lookups.
+func (mailer *Mailer) FetchLabels() ([]*gmail.Label, error) {
+	if mailer.labelCache != nil {
+		return mailer.labelCache, nil
+	}
+	resp, err := mailer.Service.Users.Labels.List(mailer.User).Do()
+	if err != nil {
+		return nil, err
+	}
+	// Sorting on the slash-split name keeps nested labels right below their parent.
+	key := func(name string) string {
+		return strings.Replace(strings.ToLower(name), "/", "\x00", -1)
+	}
+	sort.Slice(resp.Labels, func(i, j int) bool {
+		return key(resp.Labels[i].Name) < key(resp.Labels[j].Name)
+	})
+	mailer.labelCache = resp.Labels
+	return mailer.labelCache, nil
+}
+
+// LabelID resolves a label name (case-insensitive) or ID to its ID.
+func (mailer *Mailer) LabelID(nameOrID string) (string, error) {
+	labels, err := mailer.FetchLabels()
+	if err != nil {
+		return "", err
+	}
+	for _, label := range labels {
+		if label.Id == nameOrID || strings.EqualFold(label.Name, nameOrID) {
+			return label.Id, nil
+		}
+	}
+	return "", fmt.Errorf("unknown label: %s", nameOrID)
+}
+
+// LabelIDs resolves a list of label names or IDs, skipping empty entries.
+func (mailer *Mailer) LabelIDs(namesOrIDs []string) ([]string, error) {
+	ids := make([]string, 0)
+	for _, name := range namesOrIDs {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		id, err := mailer.LabelID(name)
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// ModifyLabels adds and removes labels on the thread.
+func (mailer *Mailer) ModifyLabels(thread *Thread, add, remove []string) error {
+	if err := mailer.Require(CapModify); err != nil {
+		return err
+	}
+	modReq := &gmail.ModifyThreadRequest{
+		AddLabelIds:    add,
+		RemoveLabelIds: remove,
+	}
+	_, err := mailer.Service.Users.Threads.Modify(mailer.User, thread.ID, modReq).Do()
+	if err != nil {
+		return err
+	}
+	thread.updateLabels(add, remove)
+	return nil
+}
+
+// ToggleLabel removes the label from the thread if present, otherwise adds it.
+func (mailer *Mailer) ToggleLabel(thread *Thread, labelID string) error {
+	if thread.HasLabel(labelID) {
+		return mailer.ModifyLabels(thread, nil, []string{labelID})
+	}
+	return mailer.ModifyLabels(thread, []string{labelID}, nil)
+}
+
+// LabelQuery adds and removes labels on every message matching the search query.
+func (mailer *Mailer) LabelQuery(query string, add, remove []string) (int, error) {
+	ids, err := mailer.MatchingMessages(nil, query)
+	if err != nil {
+		return 0, err
+	}
+	return len(ids), mailer.BatchApply("label", ids, add, remove)
+}
+
+// HasLabel reports whether any message in the thread carries the label.
+func (thread *Thread) HasLabel(labelID string) bool {
+	for _, id := range thread.LabelIDs {
+		if id == labelID {
+			return true
+		}
+	}
+	return false
+}
+
+func (thread *Thread) updateLabels(add, remove []string) {
+	labels := make([]string, 0)
+	for _, id := range thread.LabelIDs {
+		if !contains(remove, id) {
+			labels = append(labels, id)
+		}
+	}
+	for _, id := range add {
+		if !contains(labels, id) {
+			labels = append(labels, id)
+		}
+	}
+	thread.LabelIDs = labels
+}
+
+// FuzzyMatch reports whether the characters of pattern appear in order in value, ignoring case.
+func FuzzyMatch(pattern, value string) bool {
+	value = strings.ToLower(value)
+	for _, ch := range strings.ToLower(pattern) {
+		index := strings.IndexRune(value, ch)
+		if index < 0 {
+			return false
+		}
+		value = value[index+len(string(ch)):]
+	}
+	return true
+}
+
+func threadLabels(thread *gmail.Thread) []string {
+	seen := make(map[string]bool)
+	labels := make([]string, 0)
+	for _, msg := range thread.Messages {
+		for _, id := range msg.LabelIds {
+			if !seen[id] {
+				seen[id] = true
+				labels = append(labels, id)
+			}
+		}
+	}
+	return labels
+}
+
+// ListLabels prints the labels as an indented tree following the slash
+// hierarchy of nested label names, or as JSON when format is "json".
+func (mailer *Mailer) ListLabels(format string) error {
+	labels, err := mailer.FetchLabels()
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(labels)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tID\tTYPE\tVISIBILITY\tCOLOR")
+	for _, label := range labels {
+		parts := strings.Split(label.Name, "/")
+		name := strings.Repeat("  ", len(parts)-1) + parts[len(parts)-1]
+		color := ""
+		if label.Color != nil {
+			color = label.Color.BackgroundColor + "/" + label.Color.TextColor
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", name, label.Id, label.Type, label.LabelListVisibility, color)
+	}
+	return w.Flush()
+}
+
+// CreateLabel creates a user label. Nested labels use slashes, e.g. "Work/Projects".
+func (mailer *Mailer) CreateLabel(name, background, text, visibility string) (*gmail.Label, error) {
+	if err := mailer.Require(CapModify); err != nil {
+		return nil, err
+	}
+	label := &gmail.Label{Name: name}
+	if err := setLabelVisibility(label, visibility); err != nil {
+		return nil, err
+	}
+	if background != "" || text != "" {
+		if err := validateLabelColor(background, text); err != nil {
+			return nil, err
+		}
+		label.Color = &gmail.LabelColor{BackgroundColor: strings.ToLower(background), TextColor: strings.ToLower(text)}
+	}
+	mailer.labelCache = nil
+	return mailer.Service.Users.Labels.Create(mailer.User, label).Do()
+}
+
+// RenameLabel renames a label along with any labels nested below it.
+func (mailer *Mailer) RenameLabel(nameOrID, newName string) error {
+	if err := mailer.Require(CapModify); err != nil {
+		return err
+	}
+	id, err := mailer.LabelID(nameOrID)
+	if err != nil {
+		return err
+	}
+	labels, err := mailer.FetchLabels()
+	if err != nil {
+		return err
+	}
+	var oldName string
+	for _, label := range labels {
+		if label.Id == id {
+			oldName = label.Name
+		}
+	}
+	mailer.labelCache = nil
+	for _, label := range labels {
+		name := ""
+		switch {
+		case label.Id == id:
+			name = newName
+		case strings.HasPrefix(label.Name, oldName+"/"):
+			name = newName + strings.TrimPrefix(label.Name, oldName)
+		default:
+			continue
+		}
+		if _, err := mailer.Service.Users.Labels.Patch(mailer.User, label.Id, &gmail.Label{Name: name}).Do(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ColorLabel sets the background and text colour of a label. Gmail only
+// accepts colours from its fixed palette, e.g. "#fb4c2f".
+func (mailer *Mailer) ColorLabel(nameOrID, background, text string) error {
+	if err := mailer.Require(CapModify); err != nil {
+		return err
+	}
+	if err := validateLabelColor(background, text); err != nil {
+		return err
+	}
+	id, err := mailer.LabelID(nameOrID)
+	if err != nil {
+		return err
+	}
+	mailer.labelCache = nil
+	patch := &gmail.Label{Color: &gmail.LabelColor{BackgroundColor: strings.ToLower(background), TextColor: strings.ToLower(text)}}
+	_, err = mailer.Service.Users.Labels.Patch(mailer.User, id, patch).Do()
+	return err
+}
+
+// SetLabelVisibility shows, hides or shows-if-unread the label in the label
+// list, and shows or hides it in the message list accordingly.
+func (mailer *Mailer) SetLabelVisibility(nameOrID, visibility string) error {
+	if err := mailer.Require(CapModify); err != nil {
+		return err
+	}
+	if visibility == "" {
+		return fmt.Errorf("missing visibility, expected -visibility show|unread|hide")
+	}
+	id, err := mailer.LabelID(nameOrID)
+	if err != nil {
+		return err
+	}
+	patch := &gmail.Label{}
+	if err := setLabelVisibility(patch, visibility); err != nil {
+		return err
+	}
+	mailer.labelCache = nil
+	_, err = mailer.Service.Users.Labels.Patch(mailer.User, id, patch).Do()
+	return err
+}
+
+// DeleteLabel deletes a user label. Messages keep their other labels.
+func (mailer *Mailer) DeleteLabel(nameOrID string) error {
+	if err := mailer.Require(CapModify); err != nil {
+		return err
+	}
+	id, err := mailer.LabelID(nameOrID)
+	if err != nil {
+		return err
+	}
+	mailer.labelCache = nil
+	return mailer.Service.Users.Labels.Delete(mailer.User, id).Do()
+}
+
+func setLabelVisibility(label *gmail.Label, visibility string) error {
+	switch visibility {
+	case "":
+	case "show":
+		label.LabelListVisibility = "labelShow"
+		label.MessageListVisibility = "show"
+	case "unread":
+		label.LabelListVisibility = "labelShowIfUnread"
+		label.MessageListVisibility = "show"
+	case "hide":
+		label.LabelListVisibility = "labelHide"
+		label.MessageListVisibility = "hide"
+	default:
+		return fmt.Errorf("unknown visibility %q, expected show|unread|hide", visibility)
+	}
+	return nil
+}
+
+// LabelPalette lists the colours Gmail accepts for label backgrounds and text.
+var LabelPalette = []string{
+	"#000000", "#434343", "#666666", "#999999", "#cccccc", "#efefef", "#f3f3f3", "#ffffff",
+	"#fb4c2f", "#ffad47", "#fad165", "#16a766", "#43d692", "#4a86e8", "#a479e2", "#f691b3",
+	"#f6c5be", "#ffe6c7", "#fef1d1", "#b9e4d0", "#c6f3de", "#c9daf8", "#e4d7f5", "#fcdee8",
+	"#efa093", "#ffd6a2", "#fce8b3", "#89d3b2", "#a0eac9", "#a4c2f4", "#d0bcf1", "#fbc8d9",
+	"#e66550", "#ffbc6b", "#fcda83", "#44b984", "#68dfa9", "#6d9eeb", "#b694e8", "#f7a7c0",
+	"#cc3a21", "#eaa041", "#f2c960", "#149e60", "#3dc789", "#3c78d8", "#8e63ce", "#e07798",
+	"#ac2b16", "#cf8933", "#d5ae49", "#0b804b", "#2a9c68", "#285bac", "#653e9b", "#b65775",
+	"#822111", "#a46a21", "#aa8831", "#076239", "#1a764f", "#1c4587", "#41236d", "#83334c",
+	"#464646", "#e7e7e7", "#0d3472", "#b6cff5", "#98d7e4", "#e3d7ff", "#711a36", "#fbd3e0",
+	"#8a1c0a", "#f2b2a8", "#7a2e0b", "#ffc8af", "#7a4706", "#ffdeb5", "#594c05", "#fbe983",
+	"#684e07", "#fdedc1", "#0b4f30", "#b3efd3", "#04502e", "#a2dcc1", "#c2c2c2", "#4986e7",
+	"#2da2bb", "#b99aff", "#994a64", "#f691b2", "#ff7537", "#ffad46", "#662e37", "#ebdbde",
+	"#cca6ac", "#094228", "#42d692", "#16a765",
+}
+
+// validateLabelColor checks a colour pair before it is sent, as Gmail needs
+// both colours and only takes them from its LabelPalette.
+func validateLabelColor(background, text string) error {
+	if background == "" || text == "" {
+		return fmt.Errorf("label colours need both -bg and -fg, e.g. -bg #fb4c2f -fg #ffffff")
+	}
+	for _, color := range []string{background, text} {
+		if !contains(LabelPalette, strings.ToLower(color)) {
+			return fmt.Errorf("colour %s is not in Gmail's label palette, e.g. #fb4c2f, #16a766, #4a86e8, #ffffff", color)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package app
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/api/gmail/v1"
+)
+
+// Snooze is a thread archived until a given time, when it returns to the inbox as unread.
+type Snooze struct {
+	ThreadID string
+	Subject  string
+	Until    time.Time
+	// Account is the name of the account the thread belongs to.
+	Account string `json:",omitempty"`
+}
+
+// ThreadState holds the local mute and snooze rules of an account, kept in threads.json.
+type ThreadState struct {
+	// Muted maps muted thread IDs to their subject.
+	Muted   map[string]string
+	Snoozed []*Snooze
+	path    string
+}
+
+// LoadThreadState reads the mute and snooze rules of the account, starting empty if none exist yet.
+func LoadThreadState(account string) (*ThreadState, error) {
+	state := &ThreadState{Muted: make(map[string]string), Snoozed: make([]*Snooze, 0), path: accountDataPath(account, "threads.json")}
+	data, err := ioutil.ReadFile(state.path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(data, state)
+	if state.Muted == nil {
+		state.Muted = make(map[string]string)
+	}
+	return state, err
+}
+
+func (state *ThreadState) Save() error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(state.path, data)
+}
+
+// Mute archives the thread and keeps archiving it when new replies arrive.
+func (mailer *Mailer) Mute(threadID, subject string) error {
+	if err := mailer.Require(CapModify); err != nil {
+		return err
+	}
+	state, err := LoadThreadState(mailer.Account)
+	if err != nil {
+		return err
+	}
+	if err := mailer.Archive(&Thread{ID: threadID}); err != nil {
+		return err
+	}
+	state.Muted[threadID] = subject
+	return state.Save()
+}
+
+// Unmute stops auto-archiving the thread. It stays wherever it currently is.
+func (mailer *Mailer) Unmute(threadID string) error {
+	state, err := LoadThreadState(mailer.Account)
+	if err != nil {
+		return err
+	}
+	delete(state.Muted, threadID)
+	return state.Save()
+}
+
+// Snooze archives the thread and schedules its return to the inbox.
+func (mailer *Mailer) Snooze(threadID, subject string, until time.Time) error {
+	if err := mailer.Require(CapModify); err != nil {
+		return err
+	}
+	state, err := LoadThreadState(mailer.Account)
+	if err != nil {
+		return err
+	}
+	if err := mailer.Archive(&Thread{ID: threadID}); err != nil {
+		return err
+	}
+	state.Snoozed = append(state.removeSnooze(threadID), &Snooze{ThreadID: threadID, Subject: subject, Until: until, Account: mailer.Account})
+	sort.Slice(state.Snoozed, func(i, j int) bool {
+		return state.Snoozed[i].Until.Before(state.Snoozed[j].Until)
+	})
+	return state.Save()
+}
+
+// Unsnooze returns a snoozed thread to the inbox right away.
+func (mailer *Mailer) Unsnooze(threadID string) error {
+	state, err := LoadThreadState(mailer.Account)
+	if err != nil {
+		return err
+	}
+	if err := mailer.restore(threadID); err != nil {
+		return err
+	}
+	state.Snoozed = state.removeSnooze(threadID)
+	return state.Save()
+}
+
+// ProcessSnoozes returns every thread of the account whose snooze expired to the inbox as unread.
+func (mailer *Mailer) ProcessSnoozes() (int, error) {
+	state, err := LoadThreadState(mailer.Account)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	remaining := make([]*Snooze, 0)
+	restored := 0
+	for _, snooze := range state.Snoozed {
+		if snooze.Until.After(now) || !SameAccount(snooze.Account, mailer.Account) {
+			remaining = append(remaining, snooze)
+			continue
+		}
+		if err := mailer.restore(snooze.ThreadID); err != nil {
+			remaining = append(remaining, snooze)
+			continue
+		}
+		restored++
+	}
+	if restored == 0 {
+		return 0, nil
+	}
+	state.Snoozed = remaining
+	return restored, state.Save()
+}
+
+// ApplyMutes archives muted threads that new replies brought back to the inbox.
+func (mailer *Mailer) ApplyMutes() (int, error) {
+	state, err := LoadThreadState(mailer.Account)
+	if err != nil || len(state.Muted) == 0 {
+		return 0, err
+	}
+	archived := 0
+	for threadID := range state.Muted {
+		thread, err := mailer.Service.Users.Threads.Get(mailer.User, threadID).Format("minimal").Fields("messages/labelIds").Do()
+		if err != nil {
+			// Deleted, or a thread of another account.
+			continue
+		}
+		inInbox := false
+		for _, msg := range thread.Messages {
+			inInbox = inInbox || contains(msg.LabelIds, "INBOX")
+		}
+		if !inInbox {
+			continue
+		}
+		if err := mailer.Archive(&Thread{ID: threadID}); err != nil {
+			return archived, err
+		}
+		archived++
+	}
+	return archived, nil
+}
+
+// ThreadSubject fetches the subject of a thread, used when muting or snoozing by ID.
+func (mailer *Mailer) ThreadSubject(threadID string) (string, error) {
+	resp, err := mailer.Service.Users.Threads.Get(mailer.User, threadID).Format("metadata").MetadataHeaders("Subject").Do()
+	if err != nil {
+		return "", err
+	}
+	for _, msg := range resp.Messages {
+		for _, header := range msg.Payload.Headers {
+			if header.Name == "Subject" {
+				return header.Value, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// MatchingThreads returns the IDs of the threads matching the search query.
+func (mailer *Mailer) MatchingThreads(query string) ([]string, error) {
+	ids := make([]string, 0)
+	err := mailer.Service.Users.Threads.List(mailer.User).Q(query).MaxResults(500).Pages(context.Background(), func(r *gmail.ListThreadsResponse) error {
+		for _, thread := range r.Threads {
+			ids = append(ids, thread.Id)
+		}
+		return nil
+	})
+	return ids, err
+}
+
+// NewestThreads returns the IDs of at most limit of the newest threads
+// matching query, with Gmail's estimate of how many match in all.
+func (mailer *Mailer) NewestThreads(query string, limit int64) ([]string, int64, error) {
+	ids := make([]string, 0)
+	resp, err := mailer.Service.Users.Threads.List(mailer.User).Q(query).MaxResults(limit).Do()
+	if err != nil {
+		return ids, 0, err
+	}
+	for _, thread := range resp.Threads {
+		ids = append(ids, thread.Id)
+	}
+	return ids, resp.ResultSizeEstimate, nil
+}
+
+func (mailer *Mailer) restore(threadID string) error {
+	if err := mailer.Require(CapModify); err != nil {
+		return err
+	}
+	modReq := &gmail.ModifyThreadRequest{
+		AddLabelIds: []string{"INBOX", "UNREAD"},
+	}
+	_, err := mailer.Service.Users.Threads.Modify(mailer.User, threadID, modReq).Do()
+	return err
+}
+
+func (state *ThreadState) removeSnooze(threadID string) []*Snooze {
+	snoozed := make([]*Snooze, 0)
+	for _, snooze := range state.Snoozed {
+		if snooze.ThreadID != threadID {
+			snoozed = append(snoozed, snooze)
+		}
+	}
+	return snoozed
+}
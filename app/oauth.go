@@ -0,0 +1,168 @@
+package app
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+)
+
+// AuthTimeout bounds how long the browser sign-in may take.
+var AuthTimeout = 5 * time.Minute
+
+// authResult is the outcome of one sign-in attempt, from the browser or a paste.
+type authResult struct {
+	code string
+	err  error
+}
+
+// LoopbackToken signs in with the loopback redirect flow: the browser is sent
+// back to a listener on 127.0.0.1 with the authorization code, protected by a
+// state check and PKCE. On hosts without a browser the redirected URL, or the
+// bare code, can be pasted into in from another machine instead. Instructions
+// are written to out; in may be nil when nothing can be pasted.
+func LoopbackToken(config *oauth2.Config, in io.Reader, out io.Writer) (*oauth2.Token, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	defer listener.Close()
+
+	cfg := *config
+	cfg.RedirectURL = "http://" + listener.Addr().String() + "/"
+	state, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	challenge := sha256.Sum256([]byte(verifier))
+	authURL := cfg.AuthCodeURL(state, oauth2.AccessTypeOffline,
+		oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:])),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"))
+
+	// The first result ends the sign-in, later ones are dropped.
+	results := make(chan authResult, 1)
+	var once sync.Once
+	finish := func(result authResult) {
+		once.Do(func() { results <- result })
+	}
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			// Browsers also ask for things like /favicon.ico.
+			http.NotFound(w, r)
+			return
+		}
+		query := r.URL.Query()
+		result := parseRedirect(query, state)
+		if result.err != nil {
+			http.Error(w, "Sign-in failed: "+result.err.Error(), http.StatusBadRequest)
+		} else {
+			fmt.Fprintln(w, "thanthi is signed in, you can close this window.")
+		}
+		// A stray request or one with a forged state does not end the sign-in.
+		if result.err == nil || query.Get("error") != "" {
+			finish(result)
+		}
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	fmt.Fprintf(out, "Open the following link in your browser: \n%v\n", authURL)
+	if (headless() || openBrowser(authURL) != nil) && in != nil {
+		fmt.Fprintln(out, "If the browser is on another machine, paste the address it is redirected to (or the code) here:")
+	}
+	go func() {
+		if in == nil {
+			return
+		}
+		line, err := bufio.NewReader(in).ReadString('\n')
+		line = strings.TrimSpace(line)
+		if line == "" {
+			// Nothing pasted, keep waiting for the browser.
+			return
+		}
+		if err == io.EOF {
+			// The code was pasted without a final newline.
+			err = nil
+		}
+		if redirect, parseErr := url.Parse(line); parseErr == nil && redirect.Query().Get("code") != "" {
+			finish(parseRedirect(redirect.Query(), state))
+			return
+		}
+		finish(authResult{code: line, err: err})
+	}()
+
+	var result authResult
+	select {
+	case result = <-results:
+	case <-time.After(AuthTimeout):
+		return nil, fmt.Errorf("timed out waiting for sign-in")
+	}
+	if result.err != nil {
+		return nil, result.err
+	}
+	return cfg.Exchange(context.Background(), result.code, oauth2.SetAuthURLParam("code_verifier", verifier))
+}
+
+// parseRedirect checks the state of a redirect and returns its code or error.
+func parseRedirect(query url.Values, state string) authResult {
+	if reason := query.Get("error"); reason != "" {
+		return authResult{err: fmt.Errorf("authorization denied: %s", reason)}
+	}
+	if query.Get("state") != state {
+		return authResult{err: fmt.Errorf("state mismatch, the redirect was not for this sign-in")}
+	}
+	if query.Get("code") == "" {
+		return authResult{err: fmt.Errorf("redirect has no authorization code")}
+	}
+	return authResult{code: query.Get("code")}
+}
+
+// randomString returns 32 random bytes encoded for use in URLs.
+func randomString() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// headless reports whether no local browser is likely to be reachable.
+func headless() bool {
+	if os.Getenv("SSH_CONNECTION") != "" {
+		return true
+	}
+	if runtime.GOOS == "linux" || runtime.GOOS == "freebsd" {
+		return os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == ""
+	}
+	return false
+}
+
+// openBrowser opens the link in the local browser. Tests replace it.
+var openBrowser = func(link string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", link).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", link).Start()
+	default:
+		return exec.Command("xdg-open", link).Start()
+	}
+}
@@ -0,0 +1,186 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// fakeTokenServer accepts the code "good-code" along with the PKCE verifier
+// matching the challenge of the last sign-in.
+type fakeTokenServer struct {
+	*httptest.Server
+	challenge string
+}
+
+func newFakeTokenServer(t *testing.T) *fakeTokenServer {
+	fake := &fakeTokenServer{}
+	fake.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if r.Form.Get("code") != "good-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != fake.challenge {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_grant"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token":"access","token_type":"Bearer","refresh_token":"refresh","expires_in":3600}`)
+	}))
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+// urlWriter hands the sign-in link printed by LoopbackToken to the test.
+type urlWriter chan *url.URL
+
+func (w urlWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(string(p), "\n") {
+		if strings.HasPrefix(line, "http") {
+			if link, err := url.Parse(line); err == nil {
+				w <- link
+			}
+		}
+	}
+	return len(p), nil
+}
+
+type signIn struct {
+	link   *url.URL
+	token  *oauth2.Token
+	err    error
+	done   chan struct{}
+	server *fakeTokenServer
+}
+
+func startSignIn(t *testing.T, in io.Reader) *signIn {
+	openBrowser = func(string) error { return nil }
+	server := newFakeTokenServer(t)
+	config := &oauth2.Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Endpoint:     oauth2.Endpoint{AuthURL: "https://accounts.example.com/auth", TokenURL: server.URL + "/token"},
+	}
+	links := make(urlWriter, 1)
+	sign := &signIn{done: make(chan struct{}), server: server}
+	go func() {
+		sign.token, sign.err = LoopbackToken(config, in, links)
+		close(sign.done)
+	}()
+	select {
+	case sign.link = <-links:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no sign-in link printed")
+	}
+	server.challenge = sign.link.Query().Get("code_challenge")
+	return sign
+}
+
+// redirect returns the address the browser is sent back to with the given query.
+func (sign *signIn) redirect(query url.Values) string {
+	return sign.link.Query().Get("redirect_uri") + "?" + query.Encode()
+}
+
+func (sign *signIn) visit(t *testing.T, query url.Values) int {
+	resp, err := http.Get(sign.redirect(query))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func (sign *signIn) wait(t *testing.T) {
+	select {
+	case <-sign.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("sign-in did not finish")
+	}
+}
+
+func TestLoopbackTokenSuccess(t *testing.T) {
+	sign := startSignIn(t, nil)
+	if sign.link.Query().Get("code_challenge_method") != "S256" {
+		t.Errorf("no PKCE challenge in %s", sign.link)
+	}
+	state := sign.link.Query().Get("state")
+	if status := sign.visit(t, url.Values{"code": {"good-code"}, "state": {state}}); status != http.StatusOK {
+		t.Errorf("redirect answered %d", status)
+	}
+	sign.wait(t)
+	if sign.err != nil || sign.token.AccessToken != "access" {
+		t.Fatalf("got token %v, error %v", sign.token, sign.err)
+	}
+}
+
+func TestLoopbackTokenIgnoresBadState(t *testing.T) {
+	sign := startSignIn(t, nil)
+	state := sign.link.Query().Get("state")
+	if status := sign.visit(t, url.Values{"code": {"forged"}, "state": {"wrong"}}); status != http.StatusBadRequest {
+		t.Errorf("forged redirect answered %d", status)
+	}
+	if status := sign.visit(t, url.Values{"code": {"forged"}}); status != http.StatusBadRequest {
+		t.Errorf("redirect without state answered %d", status)
+	}
+	select {
+	case <-sign.done:
+		t.Fatalf("sign-in ended by a bad state: %v", sign.err)
+	default:
+	}
+	sign.visit(t, url.Values{"code": {"good-code"}, "state": {state}})
+	sign.wait(t)
+	if sign.err != nil {
+		t.Fatal(sign.err)
+	}
+}
+
+func TestLoopbackTokenDenied(t *testing.T) {
+	sign := startSignIn(t, nil)
+	sign.visit(t, url.Values{"error": {"access_denied"}, "state": {sign.link.Query().Get("state")}})
+	sign.wait(t)
+	if sign.err == nil || !strings.Contains(sign.err.Error(), "access_denied") {
+		t.Fatalf("expected access_denied, got %v", sign.err)
+	}
+}
+
+func TestLoopbackTokenTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { AuthTimeout = timeout }(AuthTimeout)
+	AuthTimeout = 100 * time.Millisecond
+	sign := startSignIn(t, nil)
+	sign.wait(t)
+	if sign.err == nil || !strings.Contains(sign.err.Error(), "timed out") {
+		t.Fatalf("expected a timeout, got %v", sign.err)
+	}
+}
+
+func TestLoopbackTokenPaste(t *testing.T) {
+	tests := []struct {
+		name  string
+		paste func(sign *signIn) string
+	}{
+		{"redirect url", func(sign *signIn) string {
+			return sign.redirect(url.Values{"code": {"good-code"}, "state": {sign.link.Query().Get("state")}}) + "\n"
+		}},
+		{"code", func(*signIn) string { return "good-code\n" }},
+		{"code without newline", func(*signIn) string { return "good-code" }},
+	}
+	for _, test := range tests {
+		r, w := io.Pipe()
+		sign := startSignIn(t, r)
+		io.WriteString(w, test.paste(sign))
+		w.Close()
+		sign.wait(t)
+		if sign.err != nil || sign.token.AccessToken != "access" {
+			t.Errorf("%s: got token %v, error %v", test.name, sign.token, sign.err)
+		}
+	}
+}
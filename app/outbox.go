@@ -0,0 +1,268 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ajithnn/thanthi/logger"
+	"google.golang.org/api/googleapi"
+)
+
+// DefaultUndoDelay is how long a queued mail waits in the outbox before it is sent.
+const DefaultUndoDelay = 10 * time.Second
+
+const maxBackoff = time.Hour
+
+// claimTimeout is how long a mail may stay claimed by a sender before the
+// claim is taken to be left over from a crash and the mail is queued again.
+const claimTimeout = 10 * time.Minute
+
+// OutboxItem is a composed mail waiting under outbox in the DataDir to be sent.
+type OutboxItem struct {
+	ID          string
+	Account     string
+	Params      ComposeParams
+	ReplyID     string
+	QueuedAt    time.Time
+	SendAt      time.Time
+	Attempts    int
+	NextAttempt time.Time
+	LastError   string
+	Failed      bool
+}
+
+func outboxDir() string {
+	return dataPath("outbox")
+}
+
+// UndoDelay returns the configured grace period before queued mail is sent.
+func (mailer *Mailer) UndoDelay() time.Duration {
+	if mailer.Config != nil && mailer.Config.UndoSendSeconds > 0 {
+		return time.Duration(mailer.Config.UndoSendSeconds) * time.Second
+	}
+	return DefaultUndoDelay
+}
+
+// Queue validates params and stores the mail in the outbox to be sent after the undo delay.
+func (mailer *Mailer) Queue(params *ComposeParams, replyID string) (*OutboxItem, error) {
+	return mailer.QueueAt(params, replyID, time.Now().Add(mailer.UndoDelay()))
+}
+
+// QueueAt stores the mail in the outbox to be sent at the given time.
+func (mailer *Mailer) QueueAt(params *ComposeParams, replyID string, sendAt time.Time) (*OutboxItem, error) {
+	if err := mailer.Require(CapSend); err != nil {
+		return nil, err
+	}
+	if err := ValidateRecipients(params); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	item := &OutboxItem{
+		ID:       fmt.Sprintf("%d", now.UnixNano()),
+		Account:  mailer.Account,
+		Params:   *params,
+		ReplyID:  replyID,
+		QueuedAt: now,
+		SendAt:   sendAt,
+	}
+	return item, item.save()
+}
+
+// ListOutbox returns the queued mails of the account, earliest first.
+func ListOutbox(account string) ([]*OutboxItem, error) {
+	items := make([]*OutboxItem, 0)
+	files, err := ioutil.ReadDir(outboxDir())
+	if os.IsNotExist(err) {
+		return items, nil
+	}
+	if err != nil {
+		return items, err
+	}
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), claimSuffix) && time.Since(file.ModTime()) > claimTimeout {
+			claimed := filepath.Join(outboxDir(), file.Name())
+			os.Rename(claimed, strings.TrimSuffix(claimed, claimSuffix))
+			continue
+		}
+		if !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(outboxDir(), file.Name()))
+		if os.IsNotExist(err) {
+			// Claimed by another sender since the listing.
+			continue
+		}
+		if err != nil {
+			return items, err
+		}
+		item := &OutboxItem{}
+		if err := json.Unmarshal(data, item); err != nil {
+			return items, err
+		}
+		if SameAccount(item.Account, account) {
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].SendAt.Before(items[j].SendAt)
+	})
+	return items, nil
+}
+
+// CancelOutbox removes a queued mail of the account before it is sent.
+func CancelOutbox(account, id string) (*OutboxItem, error) {
+	item := &OutboxItem{ID: id}
+	if filepath.Base(id) != id || !item.claim() {
+		return nil, fmt.Errorf("no outbox item with id %s, or it is being sent", id)
+	}
+	data, err := ioutil.ReadFile(item.claimPath())
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, item); err != nil {
+		item.release()
+		return nil, err
+	}
+	if !SameAccount(item.Account, account) {
+		item.release()
+		return nil, fmt.Errorf("outbox item %s was queued by another account", id)
+	}
+	return item, os.Remove(item.claimPath())
+}
+
+// FlushOutbox sends every queued mail of the account that is due, or only the given ids if any.
+// With force, mails still within their undo delay, waiting on a retry or
+// marked failed are sent too. Transient errors are retried later with
+// exponential backoff. Each mail is claimed before it is sent, so several
+// running instances never send the same mail twice.
+func (mailer *Mailer) FlushOutbox(force bool, ids ...string) (int, error) {
+	items, err := ListOutbox(mailer.Account)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	sent := 0
+	for _, item := range items {
+		if len(ids) > 0 && !contains(ids, item.ID) {
+			continue
+		}
+		if !force && (item.Failed || item.SendAt.After(now) || item.NextAttempt.After(now)) {
+			continue
+		}
+		if !item.claim() {
+			continue
+		}
+		err := mailer.ComposeAndSend(&item.Params, item.ReplyID)
+		if err == nil {
+			sent++
+			if err := os.Remove(item.claimPath()); err != nil {
+				return sent, err
+			}
+			continue
+		}
+		logger.NewLogger().Infof("Mailer#FlushOutbox: Sending %s failed: %v", item.ID, err)
+		item.Attempts++
+		item.LastError = err.Error()
+		if isTransient(err) {
+			item.NextAttempt = now.Add(retryBackoff(item.Attempts))
+		} else {
+			item.Failed = true
+		}
+		if err := item.save(); err != nil {
+			return sent, err
+		}
+		if err := os.Remove(item.claimPath()); err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+// NextOutboxDue returns when the next queued mail of the account becomes due, or false if none is waiting.
+func NextOutboxDue(account string) (time.Time, bool) {
+	items, err := ListOutbox(account)
+	if err != nil {
+		return time.Time{}, false
+	}
+	var next time.Time
+	found := false
+	for _, item := range items {
+		if item.Failed {
+			continue
+		}
+		due := item.SendAt
+		if item.NextAttempt.After(due) {
+			due = item.NextAttempt
+		}
+		if !found || due.Before(next) {
+			next = due
+			found = true
+		}
+	}
+	return next, found
+}
+
+// retryBackoff returns how long to wait after the given number of failed attempts.
+func retryBackoff(attempts int) time.Duration {
+	backoff := 15 * time.Second
+	for i := 0; i < attempts && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+func (item *OutboxItem) path() string {
+	return filepath.Join(outboxDir(), item.ID+".json")
+}
+
+// claimSuffix marks an outbox file taken by a sender, hiding it from ListOutbox.
+const claimSuffix = ".sending"
+
+func (item *OutboxItem) claimPath() string {
+	return item.path() + claimSuffix
+}
+
+// claim takes the item for sending. The rename is atomic, so only one of
+// several instances flushing the outbox at once gets it.
+func (item *OutboxItem) claim() bool {
+	if err := os.Rename(item.path(), item.claimPath()); err != nil {
+		return false
+	}
+	now := time.Now()
+	os.Chtimes(item.claimPath(), now, now)
+	return true
+}
+
+// release returns a claimed item to the outbox unsent.
+func (item *OutboxItem) release() error {
+	return os.Rename(item.claimPath(), item.path())
+}
+
+func (item *OutboxItem) save() error {
+	if err := os.MkdirAll(outboxDir(), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(item, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(item.path(), data, 0600)
+}
+
+func isTransient(err error) bool {
+	if apiErr, ok := err.(*googleapi.Error); ok {
+		return apiErr.Code == 429 || apiErr.Code >= 500
+	}
+	_, ok := err.(net.Error)
+	return ok
+}
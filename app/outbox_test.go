@@ -0,0 +1,72 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{0, 15 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{7, 32 * time.Minute},
+		{8, maxBackoff},
+		{64, maxBackoff},
+		{1000, maxBackoff},
+	}
+	for _, test := range tests {
+		if backoff := retryBackoff(test.attempts); backoff != test.expected {
+			t.Errorf("retryBackoff(%d) = %v, expected %v", test.attempts, backoff, test.expected)
+		}
+	}
+}
+
+func TestOutboxClaim(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	item := &OutboxItem{ID: "1", SendAt: time.Now()}
+	if err := item.save(); err != nil {
+		t.Fatal(err)
+	}
+	if !item.claim() {
+		t.Fatal("first claim failed")
+	}
+	if item.claim() {
+		t.Error("claimed an item twice")
+	}
+	if items, _ := ListOutbox(DefaultAccount); len(items) != 0 {
+		t.Errorf("claimed item still listed: %v", items)
+	}
+	if err := item.release(); err != nil {
+		t.Fatal(err)
+	}
+	if items, _ := ListOutbox(DefaultAccount); len(items) != 1 {
+		t.Errorf("released item not listed, got %d items", len(items))
+	}
+}
+
+func TestCancelOutboxAccount(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	item := &OutboxItem{ID: "1", Account: "work", SendAt: time.Now()}
+	if err := item.save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CancelOutbox(DefaultAccount, "1"); err == nil {
+		t.Fatal("cancelled another account's mail")
+	}
+	if items, _ := ListOutbox("work"); len(items) != 1 {
+		t.Fatalf("refused cancel did not release the item, got %d items", len(items))
+	}
+	if _, err := CancelOutbox("work", "../1"); err == nil {
+		t.Error("cancelled an id outside the outbox")
+	}
+	if _, err := CancelOutbox("work", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if items, _ := ListOutbox("work"); len(items) != 0 {
+		t.Errorf("cancelled item still listed: %v", items)
+	}
+}
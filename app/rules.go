@@ -0,0 +1,343 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ajithnn/thanthi/logger"
+	"golang.org/x/net/context"
+	"google.golang.org/api/gmail/v1"
+	"gopkg.in/yaml.v2"
+)
+
+// RuleMatch holds the conditions of a rule. All given conditions must hold
+// for the newest message of a thread. Patterns are case-insensitive regexps.
+type RuleMatch struct {
+	// Headers maps header names, e.g. from or list-id, to patterns.
+	Headers map[string]string `yaml:"headers,omitempty"`
+	Body    string            `yaml:"body,omitempty"`
+	// Label is a label name or ID the thread must carry.
+	Label string `yaml:"label,omitempty"`
+	// OlderThan and NewerThan are ages such as "12h", "7d", "2w", "6m" or "1y".
+	OlderThan string `yaml:"older_than,omitempty"`
+	NewerThan string `yaml:"newer_than,omitempty"`
+
+	headers   map[string]*regexp.Regexp
+	body      *regexp.Regexp
+	olderThan time.Duration
+	newerThan time.Duration
+}
+
+// Rule is a client-side rule from rules.yml in the ConfigDir, applied to newly fetched threads.
+type Rule struct {
+	Name     string    `yaml:"name"`
+	Match    RuleMatch `yaml:"match"`
+	Label    []string  `yaml:"label,omitempty"`
+	Unlabel  []string  `yaml:"unlabel,omitempty"`
+	Archive  bool      `yaml:"archive,omitempty"`
+	MarkRead bool      `yaml:"mark_read,omitempty"`
+	Forward  string    `yaml:"forward,omitempty"`
+	// Run is a shell command given the message body on stdin and its
+	// details in THANTHI_* environment variables.
+	Run string `yaml:"run,omitempty"`
+	// Stop skips the remaining rules once this one fires.
+	Stop bool `yaml:"stop,omitempty"`
+}
+
+// RuleFile is the layout of a rules YAML file.
+type RuleFile struct {
+	Rules []*Rule `yaml:"rules"`
+}
+
+// LoadRules reads and checks the rules in a YAML file. A missing file means no rules.
+func LoadRules(path string) ([]*Rule, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	file := &RuleFile{}
+	if err := yaml.UnmarshalStrict(data, file); err != nil {
+		return nil, err
+	}
+	for i, rule := range file.Rules {
+		if rule.Name == "" {
+			rule.Name = "rule " + strconv.Itoa(i+1)
+		}
+		if err := rule.compile(); err != nil {
+			return nil, fmt.Errorf("%s: %v", rule.Name, err)
+		}
+	}
+	return file.Rules, nil
+}
+
+func (rule *Rule) compile() error {
+	if len(rule.Label) == 0 && len(rule.Unlabel) == 0 && !rule.Archive && !rule.MarkRead && rule.Forward == "" && rule.Run == "" {
+		return fmt.Errorf("no actions")
+	}
+	match := &rule.Match
+	match.headers = make(map[string]*regexp.Regexp)
+	for name, pattern := range match.Headers {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return fmt.Errorf("header %s: %v", name, err)
+		}
+		match.headers[strings.ToLower(name)] = re
+	}
+	var err error
+	if match.Body != "" {
+		if match.body, err = regexp.Compile("(?i)" + match.Body); err != nil {
+			return fmt.Errorf("body: %v", err)
+		}
+	}
+	if match.olderThan, err = parseAge(match.OlderThan); err != nil {
+		return err
+	}
+	if match.newerThan, err = parseAge(match.NewerThan); err != nil {
+		return err
+	}
+	return nil
+}
+
+// parseAge parses a Gmail style age such as "7d" into a duration.
+func parseAge(age string) (time.Duration, error) {
+	if age == "" {
+		return 0, nil
+	}
+	units := map[byte]time.Duration{
+		'h': time.Hour,
+		'd': 24 * time.Hour,
+		'w': 7 * 24 * time.Hour,
+		'm': 30 * 24 * time.Hour,
+		'y': 365 * 24 * time.Hour,
+	}
+	unit, ok := units[age[len(age)-1]]
+	count, err := strconv.Atoi(age[:len(age)-1])
+	if !ok || err != nil || count < 0 {
+		return 0, fmt.Errorf("invalid age %q, expected e.g. 12h, 7d, 2w, 6m or 1y", age)
+	}
+	return time.Duration(count) * unit, nil
+}
+
+// Matches reports whether the rule's conditions hold for the thread.
+func (mailer *Mailer) Matches(rule *Rule, thread *Thread) bool {
+	if len(thread.Messages) == 0 {
+		return false
+	}
+	msg := thread.Messages[len(thread.Messages)-1]
+	match := &rule.Match
+	for name, re := range match.headers {
+		if !re.MatchString(msg.Headers[name]) {
+			return false
+		}
+	}
+	if match.body != nil && !match.body.MatchString(msg.Body) {
+		return false
+	}
+	if match.Label != "" {
+		id, err := mailer.LabelID(match.Label)
+		if err != nil || !thread.HasLabel(id) {
+			return false
+		}
+	}
+	age := time.Since(msg.Date)
+	if match.olderThan > 0 && age < match.olderThan {
+		return false
+	}
+	if match.newerThan > 0 && age > match.newerThan {
+		return false
+	}
+	return true
+}
+
+// MatchingRules returns the rules that would fire for the thread, honouring Stop.
+func (mailer *Mailer) MatchingRules(thread *Thread) []*Rule {
+	matched := make([]*Rule, 0)
+	for _, rule := range mailer.Rules {
+		if !mailer.Matches(rule, thread) {
+			continue
+		}
+		matched = append(matched, rule)
+		if rule.Stop {
+			break
+		}
+	}
+	return matched
+}
+
+// ApplyRules runs the actions of the matching rules once per new message of
+// the thread. It reports whether the thread left the listed labels or was
+// marked read, so it should no longer be shown.
+func (mailer *Mailer) ApplyRules(thread *Thread) (bool, error) {
+	if len(mailer.Rules) == 0 || len(thread.Messages) == 0 {
+		return false, nil
+	}
+	state, err := loadRuleState(mailer.Account)
+	if err != nil {
+		return false, err
+	}
+	newest := thread.Messages[len(thread.Messages)-1]
+	if state.Threads[thread.ID] == newest.ID || newest.Date.Before(state.Since) {
+		return false, nil
+	}
+	hidden := false
+	fired := mailer.MatchingRules(thread)
+	for _, rule := range fired {
+		logger.NewLogger().Infof("Mailer#ApplyRules: Rule %q fired on %s", rule.Name, thread.ID)
+		if err := mailer.applyRule(rule, thread); err != nil {
+			return hidden, fmt.Errorf("%s: %v", rule.Name, err)
+		}
+		hidden = hidden || rule.MarkRead
+	}
+	for _, label := range mailer.Labels {
+		if len(fired) > 0 && !thread.HasLabel(label) {
+			hidden = true
+		}
+	}
+	state.Threads[thread.ID] = newest.ID
+	return hidden, state.save()
+}
+
+func (mailer *Mailer) applyRule(rule *Rule, thread *Thread) error {
+	add, err := mailer.LabelIDs(rule.Label)
+	if err != nil {
+		return err
+	}
+	remove, err := mailer.LabelIDs(rule.Unlabel)
+	if err != nil {
+		return err
+	}
+	if rule.Archive {
+		remove = append(remove, "INBOX")
+	}
+	if rule.MarkRead {
+		remove = append(remove, "UNREAD")
+	}
+	if len(add) > 0 || len(remove) > 0 {
+		if err := mailer.ModifyLabels(thread, add, remove); err != nil {
+			return err
+		}
+	}
+	msg := thread.Messages[len(thread.Messages)-1]
+	if rule.Forward != "" {
+		params := &ComposeParams{
+			Mode:        "forward",
+			To:          rule.Forward,
+			Subject:     "Fwd: " + thread.Subject,
+			Body:        msg.Body,
+			NoSignature: true,
+		}
+		if err := mailer.ComposeAndSend(params, ""); err != nil {
+			return err
+		}
+	}
+	if rule.Run != "" {
+		cmd := exec.Command("sh", "-c", rule.Run)
+		cmd.Stdin = strings.NewReader(msg.Body)
+		cmd.Env = append(os.Environ(),
+			"THANTHI_RULE="+rule.Name,
+			"THANTHI_THREAD_ID="+thread.ID,
+			"THANTHI_MESSAGE_ID="+msg.ID,
+			"THANTHI_FROM="+msg.From,
+			"THANTHI_TO="+msg.To,
+			"THANTHI_SUBJECT="+thread.Subject,
+		)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("run: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+// ProcessRules applies the rules to unread inbox threads with messages that
+// arrived since the rules first ran. It returns the number of threads fetched
+// and checked.
+func (mailer *Mailer) ProcessRules() (int, error) {
+	if len(mailer.Rules) == 0 {
+		return 0, nil
+	}
+	state, err := loadRuleState(mailer.Account)
+	if err != nil {
+		return 0, err
+	}
+	// Messages are listed newest first, so the first one seen is the thread's newest.
+	newest := make(map[string]string)
+	order := make([]string, 0)
+	query := fmt.Sprintf("in:inbox is:unread after:%d", state.Since.Unix())
+	err = mailer.Service.Users.Messages.List(mailer.User).Q(query).MaxResults(500).Pages(context.Background(), func(r *gmail.ListMessagesResponse) error {
+		for _, msg := range r.Messages {
+			if _, ok := newest[msg.ThreadId]; !ok {
+				newest[msg.ThreadId] = msg.Id
+				order = append(order, msg.ThreadId)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	checked := 0
+	for _, id := range order {
+		if state.Threads[id] == newest[id] {
+			continue
+		}
+		thread, err := mailer.FetchThread(id)
+		if err != nil {
+			return checked, err
+		}
+		if _, err := mailer.ApplyRules(thread); err != nil {
+			logger.NewLogger().Infof("Mailer#ProcessRules: Rules failed on %s: %v", id, err)
+		}
+		checked++
+	}
+	return checked, nil
+}
+
+// ruleState records where the rules of an account got to, kept in rules.json.
+type ruleState struct {
+	// Since is when the rules first ran. Older mail is left alone, so
+	// forward and run actions do not fire on the whole mailbox.
+	Since time.Time `json:"since"`
+	// Threads maps thread IDs to the newest message the rules already ran on.
+	Threads map[string]string `json:"threads"`
+	path    string
+}
+
+// loadRuleState reads the rule state of the account, starting it at the
+// current time on the first run.
+func loadRuleState(account string) (*ruleState, error) {
+	state := &ruleState{path: accountDataPath(account, "rules.json")}
+	data, err := ioutil.ReadFile(state.path)
+	if err != nil && !os.IsNotExist(err) {
+		return state, err
+	}
+	if err == nil {
+		// State from older versions lacks since and starts over.
+		json.Unmarshal(data, state)
+	}
+	if state.Threads == nil {
+		state.Threads = make(map[string]string)
+	}
+	if state.Since.IsZero() {
+		state.Since = time.Now()
+		return state, state.save()
+	}
+	return state, nil
+}
+
+func (state *ruleState) save() error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(state.path, data)
+}
@@ -0,0 +1,95 @@
+package app
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+const testRules = `rules:
+  - name: newsletters
+    match:
+      headers:
+        list-id: news\.example\.com
+    archive: true
+    stop: true
+  - name: invoices
+    match:
+      headers:
+        from: billing@
+      body: invoice
+      newer_than: 7d
+    label: [Bills]
+  - name: old work
+    match:
+      label: Work
+      older_than: 30d
+    mark_read: true
+`
+
+func TestRuleMatching(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yml")
+	if err := ioutil.WriteFile(path, []byte(testRules), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := LoadRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mailer := &Mailer{Rules: rules, labelCache: []*gmail.Label{{Id: "Label_1", Name: "Work"}}}
+
+	thread := func(headers map[string]string, body string, age time.Duration, labels ...string) *Thread {
+		return &Thread{ID: "t", LabelIDs: labels, Messages: []*Message{
+			{ID: "m", Headers: headers, Body: body, Date: time.Now().Add(-age)},
+		}}
+	}
+	tests := []struct {
+		name     string
+		thread   *Thread
+		expected []string
+	}{
+		{"list header", thread(map[string]string{"list-id": "<weekly.NEWS.example.com>", "from": "billing@shop"}, "invoice", time.Hour), []string{"newsletters"}},
+		{"invoice", thread(map[string]string{"from": "Billing@shop.example"}, "Your Invoice", 24*time.Hour), []string{"invoices"}},
+		{"invoice too old", thread(map[string]string{"from": "billing@shop"}, "invoice", 8*24*time.Hour), nil},
+		{"invoice without body", thread(map[string]string{"from": "billing@shop"}, "receipt", time.Hour), nil},
+		{"old work", thread(nil, "", 31*24*time.Hour, "Label_1"), []string{"old work"}},
+		{"recent work", thread(nil, "", 24*time.Hour, "Label_1"), nil},
+		{"no messages", &Thread{ID: "t"}, nil},
+	}
+	for _, test := range tests {
+		names := make([]string, 0)
+		for _, rule := range mailer.MatchingRules(test.thread) {
+			names = append(names, rule.Name)
+		}
+		if len(names) != len(test.expected) {
+			t.Errorf("%s: fired %v, expected %v", test.name, names, test.expected)
+			continue
+		}
+		for i := range names {
+			if names[i] != test.expected[i] {
+				t.Errorf("%s: fired %v, expected %v", test.name, names, test.expected)
+			}
+		}
+	}
+}
+
+func TestLoadRulesErrors(t *testing.T) {
+	tests := map[string]string{
+		"no actions":  "rules:\n  - name: x\n    match: {body: a}\n",
+		"bad pattern": "rules:\n  - match: {body: \"(\"}\n    archive: true\n",
+		"bad age":     "rules:\n  - match: {older_than: 3x}\n    archive: true\n",
+		"unknown key": "rules:\n  - match: {bdy: a}\n    archive: true\n",
+	}
+	for name, yaml := range tests {
+		path := filepath.Join(t.TempDir(), "rules.yml")
+		if err := ioutil.WriteFile(path, []byte(yaml), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadRules(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package app
+
+import (
+	"fmt"
+	"time"
+)
+
+// SendTimeLayout is the layout accepted for scheduled send and snooze times.
+const SendTimeLayout = "2006-01-02 15:04"
+
+// ParseSendTime parses a local time such as "2026-10-18 09:00", or a bare
+// "09:00" meaning the next occurrence of that time. Times in the past are refused.
+func ParseSendTime(value string) (time.Time, error) {
+	now := time.Now()
+	at, err := time.ParseInLocation(SendTimeLayout, value, time.Local)
+	if err != nil {
+		clock, clockErr := time.ParseInLocation("15:04", value, time.Local)
+		if clockErr != nil {
+			return at, fmt.Errorf("invalid time %q, expected %s", value, SendTimeLayout)
+		}
+		at = time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, time.Local)
+		if !at.After(now) {
+			at = at.AddDate(0, 0, 1)
+		}
+	}
+	if !at.After(now) {
+		return at, fmt.Errorf("time %s is in the past", at.Format(SendTimeLayout))
+	}
+	return at, nil
+}
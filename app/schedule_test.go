@@ -0,0 +1,42 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSendTime(t *testing.T) {
+	now := time.Now()
+	tomorrow := now.AddDate(0, 0, 1).Format(SendTimeLayout)
+	clock := now.Add(-time.Hour).Format("15:04")
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{tomorrow, true},
+		{clock, true},
+		{now.AddDate(0, 0, -1).Format(SendTimeLayout), false},
+		{"2026-13-01 09:00", false},
+		{"tomorrow", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		at, err := ParseSendTime(test.value)
+		if (err == nil) != test.valid {
+			t.Errorf("ParseSendTime(%q) error = %v, expected valid %v", test.value, err, test.valid)
+			continue
+		}
+		if test.valid && !at.After(now) {
+			t.Errorf("ParseSendTime(%q) = %v, expected a future time", test.value, at)
+		}
+	}
+
+	// A bare clock time already past today means that time tomorrow.
+	at, err := ParseSendTime(clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if at.Format("15:04") != clock || at.Sub(now) > 24*time.Hour {
+		t.Errorf("ParseSendTime(%q) = %v, expected the next %s", clock, at, clock)
+	}
+}
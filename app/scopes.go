@@ -0,0 +1,90 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// Capability is something the granted scopes may or may not allow.
+type Capability string
+
+const (
+	CapRead     Capability = "read mail"
+	CapModify   Capability = "label, archive or trash mail"
+	CapSend     Capability = "send mail"
+	CapDelete   Capability = "permanently delete mail"
+	CapSettings Capability = "change filters and settings"
+)
+
+// userinfoEmailScope lets a send-only sign-in learn its own address.
+const userinfoEmailScope = "https://www.googleapis.com/auth/userinfo.email"
+
+// DefaultScopeProfile is used when -configure is given no profile.
+const DefaultScopeProfile = "full"
+
+// ScopeProfiles are the sets of scopes offered at configure time.
+var ScopeProfiles = map[string][]string{
+	"readonly": {gmail.GmailReadonlyScope},
+	"send":     {gmail.GmailSendScope, userinfoEmailScope},
+	"modify":   {gmail.GmailModifyScope, gmail.GmailSettingsBasicScope},
+	"full":     {gmail.MailGoogleComScope, gmail.GmailSettingsBasicScope},
+}
+
+// scopeCapabilities lists what each Gmail scope allows.
+var scopeCapabilities = map[string][]Capability{
+	gmail.MailGoogleComScope:      {CapRead, CapModify, CapSend, CapDelete},
+	gmail.GmailModifyScope:        {CapRead, CapModify, CapSend},
+	gmail.GmailReadonlyScope:      {CapRead},
+	gmail.GmailComposeScope:       {CapSend},
+	gmail.GmailSendScope:          {CapSend},
+	gmail.GmailSettingsBasicScope: {CapSettings},
+}
+
+// ProfileScopes returns the scopes of a profile name.
+func ProfileScopes(profile string) ([]string, error) {
+	if profile == "" {
+		profile = DefaultScopeProfile
+	}
+	scopes, ok := ScopeProfiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown scope profile %q, expected one of %s", profile, strings.Join(profileNames(), ", "))
+	}
+	return scopes, nil
+}
+
+func profileNames() []string {
+	names := make([]string, 0, len(ScopeProfiles))
+	for name := range ScopeProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Can reports whether the granted scopes allow the capability.
+func (mailer *Mailer) Can(capability Capability) bool {
+	for _, scope := range mailer.Scopes {
+		for _, allowed := range scopeCapabilities[scope] {
+			if allowed == capability {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Require returns an error explaining how to sign in again when the granted
+// scopes do not allow the capability.
+func (mailer *Mailer) Require(capability Capability) error {
+	if mailer.Can(capability) {
+		return nil
+	}
+	profile := "modify"
+	if capability == CapDelete {
+		profile = "full"
+	}
+	return fmt.Errorf("the granted scopes do not allow to %s, sign in again with thanthi -configure -scopes %s", capability, profile)
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+func TestProfileScopes(t *testing.T) {
+	tests := []struct {
+		profile string
+		want    []string
+		wantErr bool
+	}{
+		{profile: "", want: ScopeProfiles["full"]},
+		{profile: "readonly", want: []string{gmail.GmailReadonlyScope}},
+		{profile: "send", want: []string{gmail.GmailSendScope, userinfoEmailScope}},
+		{profile: "modify", want: ScopeProfiles["modify"]},
+		{profile: "admin", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ProfileScopes(tt.profile)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ProfileScopes(%q) error = %v, wantErr %v", tt.profile, err, tt.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ProfileScopes(%q) = %v, want %v", tt.profile, got, tt.want)
+		}
+	}
+}
+
+func TestCan(t *testing.T) {
+	tests := []struct {
+		profile string
+		allowed []Capability
+		denied  []Capability
+	}{
+		{"readonly", []Capability{CapRead}, []Capability{CapModify, CapSend, CapDelete, CapSettings}},
+		{"send", []Capability{CapSend}, []Capability{CapRead, CapModify, CapDelete, CapSettings}},
+		{"modify", []Capability{CapRead, CapModify, CapSend, CapSettings}, []Capability{CapDelete}},
+		{"full", []Capability{CapRead, CapModify, CapSend, CapDelete, CapSettings}, nil},
+	}
+	for _, tt := range tests {
+		mailer := &Mailer{Scopes: ScopeProfiles[tt.profile]}
+		for _, capability := range tt.allowed {
+			if !mailer.Can(capability) {
+				t.Errorf("%s: Can(%q) = false, want true", tt.profile, capability)
+			}
+			if err := mailer.Require(capability); err != nil {
+				t.Errorf("%s: Require(%q) = %v", tt.profile, capability, err)
+			}
+		}
+		for _, capability := range tt.denied {
+			if mailer.Can(capability) {
+				t.Errorf("%s: Can(%q) = true, want false", tt.profile, capability)
+			}
+			if err := mailer.Require(capability); err == nil || !strings.Contains(err.Error(), "-scopes") {
+				t.Errorf("%s: Require(%q) = %v, want a hint to sign in again", tt.profile, capability, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package app
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+// VacationOptions configures the auto-reply. Body is markdown, rendered like outgoing mail.
+// Zero Start and End leave the auto-reply on until it is turned off.
+type VacationOptions struct {
+	Subject      string
+	Body         string
+	Start        time.Time
+	End          time.Time
+	ContactsOnly bool
+}
+
+// AccountSettings are the mail access and forwarding settings shown for audit.
+type AccountSettings struct {
+	Imap                *gmail.ImapSettings
+	Pop                 *gmail.PopSettings
+	AutoForwarding      *gmail.AutoForwarding
+	ForwardingAddresses []*gmail.ForwardingAddress
+}
+
+// Vacation returns the current auto-reply settings.
+func (mailer *Mailer) Vacation() (*gmail.VacationSettings, error) {
+	return mailer.Service.Users.Settings.GetVacation(mailer.User).Do()
+}
+
+// EnableVacation turns the auto-reply on.
+func (mailer *Mailer) EnableVacation(opts *VacationOptions) error {
+	if err := mailer.Require(CapSettings); err != nil {
+		return err
+	}
+	if opts.Body == "" {
+		return fmt.Errorf("vacation reply needs a body")
+	}
+	if !opts.Start.IsZero() && !opts.End.IsZero() && !opts.End.After(opts.Start) {
+		return fmt.Errorf("vacation end must be after its start")
+	}
+	settings := &gmail.VacationSettings{
+		EnableAutoReply:    true,
+		ResponseSubject:    opts.Subject,
+		ResponseBodyHtml:   RenderMarkdown(opts.Body),
+		RestrictToContacts: opts.ContactsOnly,
+		ForceSendFields:    []string{"RestrictToContacts"},
+	}
+	if !opts.Start.IsZero() {
+		settings.StartTime = opts.Start.UnixNano() / int64(time.Millisecond)
+	}
+	if !opts.End.IsZero() {
+		settings.EndTime = opts.End.UnixNano() / int64(time.Millisecond)
+	}
+	_, err := mailer.Service.Users.Settings.UpdateVacation(mailer.User, settings).Do()
+	return err
+}
+
+// DisableVacation turns the auto-reply off, keeping its message for next time.
+func (mailer *Mailer) DisableVacation() error {
+	if err := mailer.Require(CapSettings); err != nil {
+		return err
+	}
+	settings, err := mailer.Vacation()
+	if err != nil {
+		return err
+	}
+	settings.EnableAutoReply = false
+	settings.ForceSendFields = []string{"EnableAutoReply"}
+	_, err = mailer.Service.Users.Settings.UpdateVacation(mailer.User, settings).Do()
+	return err
+}
+
+// AccountSettings fetches the IMAP, POP and forwarding settings.
+func (mailer *Mailer) AccountSettings() (*AccountSettings, error) {
+	settings := &AccountSettings{}
+	var err error
+	if settings.Imap, err = mailer.Service.Users.Settings.GetImap(mailer.User).Do(); err != nil {
+		return nil, err
+	}
+	if settings.Pop, err = mailer.Service.Users.Settings.GetPop(mailer.User).Do(); err != nil {
+		return nil, err
+	}
+	if settings.AutoForwarding, err = mailer.Service.Users.Settings.GetAutoForwarding(mailer.User).Do(); err != nil {
+		return nil, err
+	}
+	resp, err := mailer.Service.Users.Settings.ForwardingAddresses.List(mailer.User).Do()
+	if err != nil {
+		return nil, err
+	}
+	settings.ForwardingAddresses = resp.ForwardingAddresses
+	return settings, nil
+}
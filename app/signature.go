@@ -0,0 +1,68 @@
+package app
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/ajithnn/thanthi/logger"
+)
+
+// SignatureDelimiter separates the mail body from the signature (RFC 3676).
+const SignatureDelimiter = "-- "
+
+// Signature returns the HTML signature for the given From identity.
+// A markdown file at signatures/<address>.md in the ConfigDir wins, then the
+// shared signature.md, then the signature configured in Gmail for the send-as alias.
+func (mailer *Mailer) Signature(from string) string {
+	if filepath.Base(from) != from {
+		logger.NewLogger().Infof("Mailer#Signature: Refusing identity %q", from)
+		return ""
+	}
+	mailer.signaturesMu.Lock()
+	defer mailer.signaturesMu.Unlock()
+	if sig, ok := mailer.signatures[from]; ok {
+		return sig
+	}
+	if mailer.signatures == nil {
+		mailer.signatures = make(map[string]string)
+	}
+
+	var sig string
+	for _, path := range []string{configPath("signatures", from+".md"), configPath("signature.md")} {
+		data, err := ioutil.ReadFile(path)
+		if err == nil && strings.TrimSpace(string(data)) != "" {
+			sig = RenderMarkdown(string(data))
+			break
+		}
+	}
+	if sig == "" && mailer.Service != nil {
+		sendAs, err := mailer.Service.Users.Settings.SendAs.Get(mailer.User, from).Do()
+		if err != nil {
+			// Not cached, so the next mail tries again.
+			logger.NewLogger().Infof("Mailer#Signature: Unable to fetch signature for %s: %v", from, err)
+			return ""
+		}
+		sig = sendAs.Signature
+	}
+	mailer.signatures[from] = sig
+	return sig
+}
+
+// RenderBody renders the markdown body of params to HTML and appends the
+// signature of the sending identity unless the message opts out.
+func (mailer *Mailer) RenderBody(params *ComposeParams) string {
+	msg := RenderMarkdown(params.Body)
+	if params.NoSignature {
+		return msg
+	}
+	from := params.From
+	if from == "" {
+		from = mailer.User
+	}
+	sig := mailer.Signature(from)
+	if sig == "" {
+		return msg
+	}
+	return msg + "<br />\r\n" + SignatureDelimiter + "<br />\r\n" + sig
+}
@@ -0,0 +1,43 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/api/gmail/v1"
+)
+
+func TestSignatureRetriesAfterError(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			http.Error(w, `{"error": {"code": 503, "message": "backend error"}}`, http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"sendAsEmail": "me@example.com", "signature": "<b>Me</b>"}`))
+	}))
+	defer server.Close()
+	service, err := gmail.New(server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.BasePath = server.URL + "/"
+	mailer := &Mailer{Service: service, User: "me@example.com"}
+
+	if sig := mailer.Signature("me@example.com"); sig != "" {
+		t.Errorf("signature after a failed fetch = %q, expected none", sig)
+	}
+	if sig := mailer.Signature("me@example.com"); sig != "<b>Me</b>" {
+		t.Errorf("signature = %q, expected it fetched again", sig)
+	}
+	if sig := mailer.Signature("me@example.com"); sig != "<b>Me</b>" || calls != 2 {
+		t.Errorf("signature = %q after %d calls, expected it cached", sig, calls)
+	}
+	if sig := mailer.Signature("../me@example.com"); sig != "" || calls != 2 {
+		t.Errorf("signature for a path = %q after %d calls, expected it refused", sig, calls)
+	}
+}
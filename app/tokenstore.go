@@ -0,0 +1,321 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/ajithnn/thanthi/logger"
+	"github.com/zalando/go-keyring"
+	"golang.org/x/oauth2"
+	"golang.org/x/term"
+	"google.golang.org/api/gmail/v1"
+)
+
+// StoredToken is an OAuth token along with the scopes granted to it.
+type StoredToken struct {
+	oauth2.Token
+	// Scopes is empty for tokens saved by older versions, which always got full access.
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// GrantedScopes returns the scopes of the token, assuming full access for old tokens.
+func (tok *StoredToken) GrantedScopes() []string {
+	if len(tok.Scopes) == 0 {
+		return []string{gmail.MailGoogleComScope}
+	}
+	return tok.Scopes
+}
+
+// TokenStore keeps the OAuth token between runs.
+type TokenStore interface {
+	Load() (*StoredToken, error)
+	Save(tok *StoredToken) error
+	Delete() error
+	String() string
+}
+
+const (
+	keyringService = "thanthi"
+	// PassphraseEnv holds the passphrase of the encrypted token file, when set.
+	PassphraseEnv = "THANTHI_TOKEN_PASSPHRASE"
+)
+
+// OpenTokenStore returns the store of the named account picked by kind
+// (keyring, encrypted or file), or by default the one picked on first save,
+// see defaultTokenStore. For the default account a token left in the legacy
+// configs/token.json is moved into the store.
+func OpenTokenStore(kind, account string) (TokenStore, error) {
+	name := (&Account{Name: account}).tokenName()
+	var store TokenStore
+	var err error
+	if kind == "" {
+		store, err = defaultTokenStore(name)
+	} else {
+		store, err = newTokenStore(kind, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if name != "token" {
+		return store, nil
+	}
+	return store, migrateLegacyToken(store)
+}
+
+func newTokenStore(kind, name string) (TokenStore, error) {
+	switch kind {
+	case "keyring":
+		return &keyringStore{user: name}, nil
+	case "encrypted":
+		return &encryptedStore{path: tokenPath(name + ".json.age")}, nil
+	case "file":
+		return &fileStore{path: tokenPath(name + ".json")}, nil
+	}
+	return nil, fmt.Errorf("unknown token store %q, expected keyring, encrypted or file", kind)
+}
+
+// defaultTokenStore picks the keyring when one is reachable and an encrypted
+// file otherwise, and records the pick next to the tokens on first save.
+// Later runs keep to the recorded store, so a run that cannot reach the
+// keyring fails instead of quietly starting a second token in a file.
+func defaultTokenStore(name string) (TokenStore, error) {
+	marker := tokenPath(name + ".store")
+	if data, err := ioutil.ReadFile(marker); err == nil {
+		return newTokenStore(strings.TrimSpace(string(data)), name)
+	}
+	kind := "encrypted"
+	if _, err := os.Stat(tokenPath(name + ".json.age")); os.IsNotExist(err) && keyringAvailable(name) {
+		kind = "keyring"
+	}
+	store, err := newTokenStore(kind, name)
+	if err != nil {
+		return nil, err
+	}
+	return &recordedStore{TokenStore: store, kind: kind, marker: marker}, nil
+}
+
+// recordedStore records its kind in marker once a token was saved to it.
+type recordedStore struct {
+	TokenStore
+	kind   string
+	marker string
+}
+
+func (store *recordedStore) Save(tok *StoredToken) error {
+	if err := store.TokenStore.Save(tok); err != nil {
+		return err
+	}
+	return writeFile(store.marker, []byte(store.kind+"\n"))
+}
+
+// tokenPath returns the path of a token file in the DataDir.
+func tokenPath(name string) string {
+	return filepath.Join(DataDir(), name)
+}
+
+func migrateLegacyToken(store TokenStore) error {
+	legacy := filepath.Join(LegacyConfigDir, "token.json")
+	tok, err := tokenFromFile(legacy)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read legacy token %s: %v", legacy, err)
+	}
+	if err := store.Save(&StoredToken{Token: *tok}); err != nil {
+		return err
+	}
+	logger.NewLogger().Infof("OpenTokenStore: Moved %s to the %s", legacy, store)
+	return os.Remove(legacy)
+}
+
+func keyringAvailable(user string) bool {
+	_, err := keyring.Get(keyringService, user)
+	return err == nil || err == keyring.ErrNotFound
+}
+
+// keyringStore keeps the token in the OS keyring, the Secret Service on Linux.
+type keyringStore struct {
+	user string
+}
+
+func (store *keyringStore) Load() (*StoredToken, error) {
+	data, err := keyring.Get(keyringService, store.user)
+	if err == keyring.ErrNotFound {
+		return nil, os.ErrNotExist
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the OS keyring: %v", err)
+	}
+	tok := &StoredToken{}
+	return tok, json.Unmarshal([]byte(data), tok)
+}
+
+func (store *keyringStore) Save(tok *StoredToken) error {
+	data, err := json.Marshal(tok)
+	if err != nil {
+		return err
+	}
+	return keyring.Set(keyringService, store.user, string(data))
+}
+
+func (store *keyringStore) Delete() error {
+	if err := keyring.Delete(keyringService, store.user); err != keyring.ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+func (store *keyringStore) String() string {
+	return "OS keyring entry " + store.user
+}
+
+// encryptedStore keeps the token in an age file encrypted with a passphrase,
+// read from THANTHI_TOKEN_PASSPHRASE or asked for on the terminal.
+type encryptedStore struct {
+	path       string
+	passphrase string
+}
+
+func (store *encryptedStore) Load() (*StoredToken, error) {
+	data, err := ioutil.ReadFile(store.path)
+	if err != nil {
+		return nil, err
+	}
+	passphrase, err := store.askPassphrase(false)
+	if err != nil {
+		return nil, err
+	}
+	identity, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	r, err := age.Decrypt(bytes.NewReader(data), identity)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt %s: %v", store.path, err)
+	}
+	tok := &StoredToken{}
+	return tok, json.NewDecoder(r).Decode(tok)
+}
+
+func (store *encryptedStore) Save(tok *StoredToken) error {
+	passphrase, err := store.askPassphrase(true)
+	if err != nil {
+		return err
+	}
+	recipient, err := age.NewScryptRecipient(passphrase)
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	w, err := age.Encrypt(buf, recipient)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(w).Encode(tok); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return writeFile(store.path, buf.Bytes())
+}
+
+func (store *encryptedStore) Delete() error {
+	if err := os.Remove(store.path); !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (store *encryptedStore) String() string {
+	return "encrypted file " + store.path
+}
+
+// NeedsPassphrase reports whether loading from store would ask for a
+// passphrase on the terminal, as THANTHI_TOKEN_PASSPHRASE is not set.
+func NeedsPassphrase(store TokenStore) bool {
+	if recorded, ok := store.(*recordedStore); ok {
+		store = recorded.TokenStore
+	}
+	encrypted, ok := store.(*encryptedStore)
+	return ok && encrypted.passphrase == "" && os.Getenv(PassphraseEnv) == ""
+}
+
+// askPassphrase returns the passphrase, asking once per run. A new
+// passphrase is asked for twice.
+func (store *encryptedStore) askPassphrase(confirm bool) (string, error) {
+	if store.passphrase == "" {
+		store.passphrase = os.Getenv(PassphraseEnv)
+	}
+	if store.passphrase != "" {
+		return store.passphrase, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", fmt.Errorf("no terminal to ask for the token passphrase, set %s", PassphraseEnv)
+	}
+	passphrase, err := readPassphrase("Token passphrase: ")
+	if err != nil {
+		return "", err
+	}
+	if confirm {
+		again, err := readPassphrase("Repeat passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if again != passphrase {
+			return "", fmt.Errorf("passphrases do not match")
+		}
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("empty passphrase")
+	}
+	store.passphrase = passphrase
+	return passphrase, nil
+}
+
+func readPassphrase(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	data, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	return string(data), err
+}
+
+// fileStore keeps the token in plain JSON, as older versions did.
+type fileStore struct {
+	path string
+}
+
+func (store *fileStore) Load() (*StoredToken, error) {
+	data, err := ioutil.ReadFile(store.path)
+	if err != nil {
+		return nil, err
+	}
+	tok := &StoredToken{}
+	return tok, json.Unmarshal(data, tok)
+}
+
+func (store *fileStore) Save(tok *StoredToken) error {
+	data, err := json.Marshal(tok)
+	if err != nil {
+		return err
+	}
+	return writeFile(store.path, data)
+}
+
+func (store *fileStore) Delete() error {
+	if err := os.Remove(store.path); !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (store *fileStore) String() string {
+	return "file " + store.path
+}
@@ -0,0 +1,190 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+// chdir runs the test from a fresh directory, where the legacy configs
+// directory is looked for, and lets the legacy move run again.
+func chdir(t *testing.T) string {
+	dir := t.TempDir()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(cwd)
+		legacyOnce = sync.Once{}
+	})
+	legacyOnce = sync.Once{}
+	return dir
+}
+
+func TestTokenStoreRoundTrip(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv(PassphraseEnv, "correct horse")
+	tok := &StoredToken{Token: oauth2.Token{AccessToken: "access", RefreshToken: "refresh"}, Scopes: []string{"s"}}
+	for _, kind := range []string{"file", "encrypted"} {
+		store, err := OpenTokenStore(kind, "work")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Load(); !os.IsNotExist(err) {
+			t.Errorf("%s: load before save = %v, expected not exist", kind, err)
+		}
+		if err := store.Save(tok); err != nil {
+			t.Fatalf("%s: %v", kind, err)
+		}
+		loaded, err := store.Load()
+		if err != nil || loaded.RefreshToken != "refresh" || len(loaded.Scopes) != 1 {
+			t.Errorf("%s: loaded %+v, %v", kind, loaded, err)
+		}
+		if kind == "encrypted" {
+			data, _ := ioutil.ReadFile(tokenPath("token-work.json.age"))
+			if bytes.Contains(data, []byte("refresh")) {
+				t.Error("encrypted store wrote the token in plain text")
+			}
+			wrong := &encryptedStore{path: tokenPath("token-work.json.age"), passphrase: "wrong"}
+			if _, err := wrong.Load(); err == nil {
+				t.Error("decrypted with the wrong passphrase")
+			}
+		}
+		if err := store.Delete(); err != nil {
+			t.Errorf("%s: delete: %v", kind, err)
+		}
+	}
+}
+
+func TestDefaultTokenStoreRecorded(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv(PassphraseEnv, "correct horse")
+	if keyringAvailable("token-work") {
+		t.Skip("an OS keyring is reachable")
+	}
+	store, err := OpenTokenStore("", "work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(&StoredToken{Token: oauth2.Token{RefreshToken: "refresh"}}); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(tokenPath("token-work.store")); string(data) != "encrypted\n" {
+		t.Errorf("recorded store %q, expected encrypted", data)
+	}
+
+	// A token recorded in the keyring is not looked for in a file when the keyring is unreachable.
+	if err := writeFile(tokenPath("token-work.store"), []byte("keyring\n")); err != nil {
+		t.Fatal(err)
+	}
+	store, err = OpenTokenStore("", "work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := store.(*keyringStore); !ok {
+		t.Fatalf("opened %s, expected the recorded keyring", store)
+	}
+	if _, err := store.Load(); err == nil || os.IsNotExist(err) {
+		t.Errorf("load from an unreachable keyring = %v, expected an error other than not exist", err)
+	}
+}
+
+// failingStore refuses every save.
+type failingStore struct{ fileStore }
+
+func (store *failingStore) Save(tok *StoredToken) error {
+	return errors.New("store unavailable")
+}
+
+func TestMigrateLegacyToken(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	dir := chdir(t)
+	legacy := filepath.Join(dir, LegacyConfigDir, "token.json")
+	if err := writeFile(legacy, []byte(`{"access_token":"access","refresh_token":"refresh"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	failing := &failingStore{fileStore{path: filepath.Join(dir, "unused.json")}}
+	if err := migrateLegacyToken(failing); err == nil {
+		t.Error("failed save not reported")
+	}
+	if _, err := os.Stat(legacy); err != nil {
+		t.Fatalf("legacy token removed after a failed save: %v", err)
+	}
+
+	store := &fileStore{path: tokenPath("token.json")}
+	if err := migrateLegacyToken(store); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Errorf("legacy token left after moving it: %v", err)
+	}
+	if tok, err := store.Load(); err != nil || tok.RefreshToken != "refresh" {
+		t.Errorf("moved token = %+v, %v", tok, err)
+	}
+	if err := migrateLegacyToken(store); err != nil {
+		t.Errorf("second run: %v", err)
+	}
+}
+
+func TestMigrateLegacyDir(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	dir := chdir(t)
+	legacy := func(name string) string { return filepath.Join(dir, LegacyConfigDir, name) }
+	for name, data := range map[string]string{
+		"config.json":   `{"undo_send_seconds": 5}`,
+		"contacts.json": `{"Entries": {}}`,
+		"threads.json":  `{"Muted": {"old": "legacy"}}`,
+	} {
+		if err := writeFile(legacy(name), []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	existing := filepath.Join(DataDir(), "threads.json")
+	if err := writeFile(existing, []byte(`{"Muted": {"new": "current"}}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	if path := dataPath("contacts.json"); path != filepath.Join(DataDir(), "contacts.json") {
+		t.Fatalf("dataPath = %s", path)
+	}
+	if _, err := os.Stat(filepath.Join(ConfigDir(), "config.json")); err != nil {
+		t.Errorf("config.json not moved: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(DataDir(), "contacts.json")); err != nil {
+		t.Errorf("contacts.json not moved: %v", err)
+	}
+	if _, err := os.Stat(legacy("contacts.json")); !os.IsNotExist(err) {
+		t.Errorf("moved contacts.json left behind: %v", err)
+	}
+	if data, _ := ioutil.ReadFile(existing); string(data) != `{"Muted": {"new": "current"}}` {
+		t.Errorf("existing threads.json overwritten with %s", data)
+	}
+	if _, err := os.Stat(legacy("threads.json")); err != nil {
+		t.Errorf("legacy threads.json removed although not moved: %v", err)
+	}
+}
+
+func TestMigrateLegacyDirIgnoresOtherProjects(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := chdir(t)
+	other := filepath.Join(dir, LegacyConfigDir, "config.json")
+	if err := writeFile(other, []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	configPath("config.json")
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("config.json of another project moved: %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// Compose view lines holding the recipient lists, used to point at the offending field.
+const (
+	FieldTo  = 0
+	FieldCc  = 1
+	FieldBcc = 2
+)
+
+// RecipientError reports a recipient list that could not be parsed.
+type RecipientError struct {
+	Field int
+	Name  string
+	Err   error
+}
+
+func (e *RecipientError) Error() string {
+	return fmt.Sprintf("invalid %s: %v", e.Name, e.Err)
+}
+
+// ValidateRecipients parses the To, Cc and Bcc lists of params and refuses
+// a message without any recipient.
+func ValidateRecipients(params *ComposeParams) error {
+	total := 0
+	fields := []struct {
+		field int
+		name  string
+		value string
+	}{
+		{FieldTo, "To", params.To},
+		{FieldCc, "Cc", params.Cc},
+		{FieldBcc, "Bcc", params.Bcc},
+	}
+	for _, f := range fields {
+		if strings.TrimSpace(f.value) == "" {
+			continue
+		}
+		addresses, err := mail.ParseAddressList(f.value)
+		if err != nil {
+			return &RecipientError{Field: f.field, Name: f.name, Err: err}
+		}
+		total += len(addresses)
+	}
+	if total == 0 {
+		return &RecipientError{Field: FieldTo, Name: "To", Err: errors.New("no recipients")}
+	}
+	return nil
+}
+
+// ExternalRecipients returns the recipients outside the configured internal
+// domains. It is always empty when no internal domains are configured.
+func (mailer *Mailer) ExternalRecipients(params *ComposeParams) []string {
+	external := make([]string, 0)
+	if mailer.Config == nil || len(mailer.Config.InternalDomains) == 0 {
+		return external
+	}
+	for _, field := range []string{params.To, params.Cc, params.Bcc} {
+		addresses, err := mail.ParseAddressList(field)
+		if err != nil {
+			continue
+		}
+		for _, address := range addresses {
+			if !mailer.isInternal(address.Address) {
+				external = append(external, address.Address)
+			}
+		}
+	}
+	return external
+}
+
+func (mailer *Mailer) isInternal(address string) bool {
+	domain := strings.ToLower(address[strings.LastIndex(address, "@")+1:])
+	for _, internal := range mailer.Config.InternalDomains {
+		internal = strings.ToLower(strings.TrimPrefix(internal, "@"))
+		if domain == internal || strings.HasSuffix(domain, "."+internal) {
+			return true
+		}
+	}
+	return false
+}
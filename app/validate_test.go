@@ -0,0 +1,37 @@
+package app
+
+import "testing"
+
+func TestValidateRecipients(t *testing.T) {
+	tests := []struct {
+		name   string
+		params ComposeParams
+		field  int
+		valid  bool
+	}{
+		{"single to", ComposeParams{To: "a@example.com"}, 0, true},
+		{"named list", ComposeParams{To: "A <a@example.com>, b@example.com"}, 0, true},
+		{"bcc only", ComposeParams{Bcc: "b@example.com"}, 0, true},
+		{"no recipients", ComposeParams{To: "  "}, FieldTo, false},
+		{"bad to", ComposeParams{To: "not an address"}, FieldTo, false},
+		{"bad cc", ComposeParams{To: "a@example.com", Cc: "a@@example"}, FieldCc, false},
+		{"bad bcc", ComposeParams{To: "a@example.com", Bcc: "<b@example.com"}, FieldBcc, false},
+	}
+	for _, test := range tests {
+		err := ValidateRecipients(&test.params)
+		if test.valid {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", test.name, err)
+			}
+			continue
+		}
+		recipientErr, ok := err.(*RecipientError)
+		if !ok {
+			t.Errorf("%s: expected a RecipientError, got %v", test.name, err)
+			continue
+		}
+		if recipientErr.Field != test.field {
+			t.Errorf("%s: field %d, expected %d", test.name, recipientErr.Field, test.field)
+		}
+	}
+}
@@ -2,12 +2,15 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/ajithnn/thanthi/app"
 	"github.com/ajithnn/thanthi/render"
@@ -15,25 +18,83 @@ import (
 )
 
 func main() {
-	mode := flag.String("m", "labels", "send - To send Emails|read - Read emails|clear - Clear all for given labels|labels - List valid labels")
+	mode := flag.String("m", "labels", "send - To send Emails|read - Read emails|clear - Trash (or -permanent delete) mail for given labels/query|labels - List or manage labels (-action list|create|rename|color|visibility|delete)|preview - Preview md body given with -f|contacts - Query (-q) or import (-f vcf/csv) contacts|outbox - List, flush or cancel (-action, -id) queued mail|daemon - Deliver scheduled mail in the background|label - Add/remove labels (-add, -remove) on mail matching -q|bulk - Apply -action read|unread|archive|label|trash|delete to mail matching -q|mute - List, add or remove (-action, -id or -q) muted threads|snooze - List, add (-at) or remove (-action, -id or -q) snoozed threads|filters - List, create (flags or -f YAML) or delete (-id) Gmail filters|filters-sync - Plan syncing Gmail filters to the -f YAML file, -action sync to apply it or export to write it|rules-test - Show which local rules (rules.yml or -f) would fire for mail matching -q|vacation - Show or turn the auto-reply -action on|off (-s, -f body, -at, -until, -contactsonly)|settings - Show IMAP, POP and forwarding settings|auth-status - Show the signed in account, granted scopes and token expiry")
 	subject := flag.String("s", "subject", "EMail Subject for send mode")
 	to := flag.String("t", "to", "comma separated 'TO' list for send mode")
 	cc := flag.String("cc", "", "comma separated 'CC' list for send mode")
 	bcc := flag.String("bcc", "", "comma separated 'BCC' list for send mode")
 	file := flag.String("f", "", "File containing EMail body in md format for send mode")
+	from := flag.String("from", "", "Send-as alias used in the From header for send mode")
+	noSig := flag.Bool("nosig", false, "Skip appending the signature in send mode")
+	at := flag.String("at", "", "Schedule send mode delivery, snooze until or start the vacation reply, e.g. \"2026-10-18 09:00\"")
+	until := flag.String("until", "", "End of the vacation reply, e.g. \"2026-10-25 18:00\"")
+	contactsOnly := flag.Bool("contactsonly", false, "Only send the vacation reply to contacts")
+	query := flag.String("q", "", "Search query for contacts, label, clear and bulk modes")
+	olderThan := flag.String("older", "", "Only clear mail older than this age, e.g. 30d, 6m, 1y")
+	dryRun := flag.Bool("dryrun", false, "Only count the mail clear mode would affect")
+	permanent := flag.Bool("permanent", false, "Permanently delete instead of moving to trash in clear mode")
+	yes := flag.Bool("yes", false, "Skip the typed confirmation in clear and bulk modes")
+	restart := flag.Bool("restart", false, "Discard a saved unfinished bulk job and start over")
+	addLabels := flag.String("add", "", "comma separated label names to add in label mode")
+	removeLabels := flag.String("remove", "", "comma separated label names to remove in label mode")
+	action := flag.String("action", "list", "Action for outbox mode: list|flush|cancel, labels mode: list|create|rename|color|visibility|delete, bulk mode: read|unread|archive|label|trash|delete, mute and snooze modes: list|add|remove, filters mode: list|create|delete, filters-sync mode: list|sync|export, vacation mode: status|on|off")
+	name := flag.String("name", "", "Label name or ID for labels mode actions, nested with slashes e.g. Work/Projects")
+	newName := flag.String("newname", "", "New label name for the rename action")
+	bgColor := flag.String("bg", "", "Label background colour, e.g. #fb4c2f")
+	fgColor := flag.String("fg", "", "Label text colour, e.g. #ffffff")
+	visibility := flag.String("visibility", "", "Label visibility: show|unread|hide")
+	attachment := flag.Bool("attachment", false, "Filter criterion: mail has an attachment")
+	size := flag.String("size", "", "Filter criterion: mail size, e.g. >5M or <100K")
+	forward := flag.String("forward", "", "Filter action: forward matching mail to this address")
+	format := flag.String("format", "table", "Output format for labels mode: table|json")
+	id := flag.String("id", "", "Outbox item ID for flush and cancel actions, thread ID for mute and snooze modes")
 	label := flag.String("l", "IMPORTANT", "comma separated Labels needed for clear and read modes")
 	configure := flag.Bool("configure", false, "Used configure oauth creds for account.Re-run to change account.")
+	credentials := flag.String("credentials", "", "OAuth client credentials file, default the account's, $THANTHI_CREDENTIALS or credentials.json in the config dir")
+	accountName := flag.String("account", "", "Named account from config.json to use, default its default_account")
+	scopeProfile := flag.String("scopes", app.DefaultScopeProfile, "Access to ask for when configuring: readonly|send|modify|full")
 
 	flag.Parse()
 
-	box := packr.NewBox("../configs/")
-	creds, err := box.Find("credentials.json")
+	if *mode == "preview" {
+		if *file == "" {
+			log.Fatalf("preview mode needs the markdown file to render: thanthi -m preview -f <file.md>")
+		}
+		body, err := ioutil.ReadFile(*file)
+		if err != nil {
+			log.Fatalf("Unable to read %s: %v", *file, err)
+		}
+		text, err := app.PreviewMarkdown(string(body))
+		if err != nil {
+			log.Fatalf("Unable to render preview: %v", err)
+		}
+		fmt.Println(text)
+		os.Exit(0)
+	}
+
+	account, err := loadAccount(*accountName)
+	if err != nil {
+		log.Fatalf("Unable to load account: %v", err)
+	}
+
+	if *mode == "contacts" {
+		if err := queryContacts(account, *query, *file); err != nil {
+			log.Fatalf("Command Failed: %v", err)
+		}
+		os.Exit(0)
+	}
+	creds, source, err := loadCredentials(account, *credentials)
 	if err != nil {
 		log.Fatalf("Unable to read client secret file: %v", err)
 	}
 
 	if *configure {
-		err := app.FetchToken(creds)
+		fmt.Printf("Signing in account %s using OAuth client from %s\n", account.Name, source)
+		scopes, err := app.ProfileScopes(*scopeProfile)
+		if err != nil {
+			log.Fatalf("Unable to configure Token. %v", err)
+		}
+		err = app.FetchToken(creds, scopes, account)
 		if err != nil {
 			log.Fatalf("Unable to configure Token. %v", err)
 		}
@@ -41,15 +102,44 @@ func main() {
 		os.Exit(0)
 	}
 
-	mailer, err := app.NewMailer(creds, *label)
+	if *mode == "auth-status" {
+		if err := authStatus(creds, account); err != nil {
+			log.Fatalf("Command Failed: %v", err)
+		}
+		os.Exit(0)
+	}
+
+	mailer, err := app.NewMailer(creds, *label, account)
+	if app.IsReauthRequired(err) {
+		fmt.Print("The saved sign-in was revoked or has expired. Sign in again now? [y/N]: ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.ToLower(strings.TrimSpace(answer)) == "y" {
+			if err = reauthorize(creds, *scopeProfile, account); err == nil {
+				mailer, err = app.NewMailer(creds, *label, account)
+			}
+		}
+	}
 	if err != nil {
 		log.Fatalf("Unable to create client handler: %v", err)
 	}
 
+	// Deliver mail and unsnooze threads that became due while thanthi was not running.
+	if *mode != "outbox" && *mode != "daemon" && *mode != "rules-test" {
+		if err := mailer.RunDueTasks(); err != nil {
+			log.Printf("Unable to run due tasks: %v", err)
+		}
+	}
+
 	switch *mode {
 	case "clear":
-		labels := strings.Split(*label, ",")
-		err = mailer.DeleteAll(labels)
+		opts := &app.ClearOptions{Query: *query, OlderThan: *olderThan, Permanent: *permanent}
+		if isFlagSet("l") {
+			opts.Labels, err = mailer.LabelIDs(strings.Split(*label, ","))
+			if err != nil {
+				break
+			}
+		}
+		err = clearMail(mailer, opts, *dryRun, *yes)
 	case "send":
 		msg := ""
 		if *file != "" {
@@ -57,25 +147,90 @@ func main() {
 		} else {
 			msg = readMailBody()
 		}
+		if *from != "" && !mailer.IsAlias(*from) {
+			log.Fatalf("Unknown send-as alias: %s", *from)
+		}
 		params := app.ComposeParams{
-			"new",
-			*to,
-			*bcc,
-			*cc,
-			*subject,
-			msg,
-			"",
+			Mode:        "new",
+			From:        *from,
+			To:          *to,
+			Bcc:         *bcc,
+			Cc:          *cc,
+			Subject:     *subject,
+			Body:        msg,
+			NoSignature: *noSig,
+		}
+		if external := mailer.ExternalRecipients(&params); len(external) > 0 {
+			fmt.Fprintf(os.Stderr, "Warning: sending to external recipients: %s\n", strings.Join(external, ", "))
+		}
+		if *at != "" {
+			err = scheduleMail(mailer, &params, *at)
+			break
 		}
 		err = mailer.ComposeAndSend(&params, "new")
 	case "read":
 		r, err := render.NewRenderer(mailer)
+		r.OpenAccount = func(name string) (*app.Mailer, error) {
+			return openAccount(name, *credentials, *label)
+		}
 		err = mailer.ListMail("init")
 		if err == nil {
 			defer r.Close()
 			r.Show()
 		}
 	case "labels":
-		err = mailer.ListLabels()
+		err = manageLabels(mailer, *action, *name, *newName, *bgColor, *fgColor, *visibility, *format)
+	case "outbox":
+		err = manageOutbox(mailer, *action, *id)
+	case "bulk":
+		// -action defaults to list for the other modes, which is no bulk action.
+		if !isFlagSet("action") {
+			err = fmt.Errorf("bulk mode needs -action %s", strings.Join(app.BulkActions, "|"))
+			break
+		}
+		err = runBulk(mailer, *query, *action, *addLabels, *removeLabels, *dryRun, *yes, *restart)
+	case "filters":
+		spec := &app.FilterSpec{Query: *query, HasAttachment: *attachment, Size: *size, Forward: *forward}
+		if isFlagSet("from") {
+			spec.From = *from
+		}
+		if isFlagSet("t") {
+			spec.To = *to
+		}
+		if isFlagSet("s") {
+			spec.Subject = *subject
+		}
+		spec.AddLabels = splitList(*addLabels)
+		spec.RemoveLabels = splitList(*removeLabels)
+		err = manageFilters(mailer, *action, *id, *file, *format, spec)
+	case "filters-sync":
+		err = syncFilters(mailer, *action, *file, *dryRun, *yes)
+	case "mute", "snooze":
+		err = manageThreads(mailer, *mode, *action, *id, *query, *at)
+	case "vacation":
+		opts := &app.VacationOptions{ContactsOnly: *contactsOnly}
+		if *action == "on" {
+			if isFlagSet("s") {
+				opts.Subject = *subject
+			}
+			if *file != "" {
+				opts.Body = readMailFromFile(*file)
+			} else {
+				opts.Body = readMailBody()
+			}
+			if opts.Start, opts.End, err = vacationWindow(*at, *until); err != nil {
+				break
+			}
+		}
+		err = manageVacation(mailer, *action, opts)
+	case "settings":
+		err = showSettings(mailer)
+	case "rules-test":
+		err = testRules(mailer, *query, *file)
+	case "label":
+		err = applyLabels(mailer, *query, *addLabels, *removeLabels)
+	case "daemon":
+		err = mailer.RunDaemon(time.Minute)
 	default:
 		log.Fatalf("Unknown mode: Usage thanthi -m send|delete-all|read [options]")
 	}
@@ -85,6 +240,605 @@ func main() {
 	}
 }
 
+// loadAccount resolves the named account, or the default one, from config.json.
+func loadAccount(name string) (*app.Account, error) {
+	config, err := app.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return config.Account(name)
+}
+
+// loadCredentials reads the OAuth client of the account, the -credentials flag first.
+func loadCredentials(account *app.Account, path string) ([]byte, string, error) {
+	if path == "" {
+		path = account.Credentials
+	}
+	return app.LoadCredentials(path, func() ([]byte, error) {
+		// Credentials embedded by packr at build time, if any.
+		return packr.NewBox("../configs/").Find("credentials.json")
+	})
+}
+
+// openAccount signs in the named account for the account switcher of read mode.
+func openAccount(name, credentials, label string) (*app.Mailer, error) {
+	account, err := loadAccount(name)
+	if err != nil {
+		return nil, err
+	}
+	creds, _, err := loadCredentials(account, credentials)
+	if err != nil {
+		return nil, err
+	}
+	// The terminal belongs to the TUI, so there is no asking for a passphrase.
+	store, err := account.OpenTokenStore()
+	if err != nil {
+		return nil, err
+	}
+	if app.NeedsPassphrase(store) {
+		return nil, fmt.Errorf("its token is encrypted, set %s to switch to it", app.PassphraseEnv)
+	}
+	mailer, err := app.NewMailer(creds, label, account)
+	if app.IsReauthRequired(err) {
+		return nil, fmt.Errorf("%v: thanthi -configure -account %s", err, account.Name)
+	}
+	return mailer, err
+}
+
+func authStatus(creds []byte, account *app.Account) error {
+	info, err := app.AuthStatus(creds, account)
+	if info != nil {
+		fmt.Printf("Name:\t%s\n", account.Name)
+		fmt.Printf("Token store:\t%s\n", info.Store)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Account:\t%s\n", info.Account)
+	fmt.Printf("Scopes:\t%s\n", strings.Join(info.Scopes, " "))
+	if !info.Expiry.IsZero() {
+		fmt.Printf("Access token expires:\t%s (in %s)\n", info.Expiry.Local().Format(app.SendTimeLayout), time.Until(info.Expiry).Round(time.Second))
+	}
+	if info.Refreshable {
+		fmt.Println("Refresh token:\tpresent")
+	} else {
+		fmt.Println("Refresh token:\tmissing, sign in again when the access token expires")
+	}
+	return nil
+}
+
+func vacationWindow(start, end string) (time.Time, time.Time, error) {
+	var from, until time.Time
+	var err error
+	if start != "" {
+		if from, err = app.ParseSendTime(start); err != nil {
+			return from, until, err
+		}
+	}
+	if end != "" {
+		until, err = app.ParseSendTime(end)
+	}
+	return from, until, err
+}
+
+func manageVacation(mailer *app.Mailer, action string, opts *app.VacationOptions) error {
+	switch action {
+	case "on":
+		if err := mailer.EnableVacation(opts); err != nil {
+			return err
+		}
+		fmt.Println("Vacation reply enabled")
+		return nil
+	case "off":
+		if err := mailer.DisableVacation(); err != nil {
+			return err
+		}
+		fmt.Println("Vacation reply disabled")
+		return nil
+	case "list", "status":
+	default:
+		return fmt.Errorf("unknown vacation action: %s", action)
+	}
+	vacation, err := mailer.Vacation()
+	if err != nil {
+		return err
+	}
+	if !vacation.EnableAutoReply {
+		fmt.Println("Vacation reply: off")
+		return nil
+	}
+	fmt.Println("Vacation reply: on")
+	if vacation.StartTime > 0 {
+		fmt.Printf("From:\t%s\n", time.Unix(0, vacation.StartTime*int64(time.Millisecond)).Format(app.SendTimeLayout))
+	}
+	if vacation.EndTime > 0 {
+		fmt.Printf("Until:\t%s\n", time.Unix(0, vacation.EndTime*int64(time.Millisecond)).Format(app.SendTimeLayout))
+	}
+	fmt.Printf("Contacts only:\t%v\n", vacation.RestrictToContacts)
+	fmt.Printf("Domain only:\t%v\n", vacation.RestrictToDomain)
+	fmt.Printf("Subject:\t%s\n\n", vacation.ResponseSubject)
+	body := vacation.ResponseBodyPlainText
+	if vacation.ResponseBodyHtml != "" {
+		if body, err = app.HTMLToText(vacation.ResponseBodyHtml); err != nil {
+			return err
+		}
+	}
+	fmt.Println(body)
+	return nil
+}
+
+func showSettings(mailer *app.Mailer) error {
+	settings, err := mailer.AccountSettings()
+	if err != nil {
+		return err
+	}
+	imap := settings.Imap
+	fmt.Printf("IMAP:\t%s\n", onOff(imap.Enabled))
+	if imap.Enabled {
+		fmt.Printf("\tauto expunge: %v, expunge behavior: %s, folder size limit: %d\n", imap.AutoExpunge, imap.ExpungeBehavior, imap.MaxFolderSize)
+	}
+	pop := settings.Pop
+	fmt.Printf("POP:\t%s\n", pop.AccessWindow)
+	if pop.AccessWindow != "disabled" {
+		fmt.Printf("\tdisposition: %s\n", pop.Disposition)
+	}
+	forwarding := settings.AutoForwarding
+	fmt.Printf("Auto-forwarding:\t%s\n", onOff(forwarding.Enabled))
+	if forwarding.Enabled {
+		fmt.Printf("\tto: %s, disposition: %s\n", forwarding.EmailAddress, forwarding.Disposition)
+	}
+	fmt.Println("Forwarding addresses:")
+	if len(settings.ForwardingAddresses) == 0 {
+		fmt.Println("\tnone")
+	}
+	for _, address := range settings.ForwardingAddresses {
+		fmt.Printf("\t%s\t%s\n", address.ForwardingEmail, address.VerificationStatus)
+	}
+	return nil
+}
+
+func onOff(enabled bool) string {
+	if enabled {
+		return "on"
+	}
+	return "off"
+}
+
+const rulesTestLimit = 50
+
+func testRules(mailer *app.Mailer, query, file string) error {
+	if file != "" {
+		rules, err := app.LoadRules(file)
+		if err != nil {
+			return err
+		}
+		mailer.Rules = rules
+	}
+	if len(mailer.Rules) == 0 {
+		return fmt.Errorf("no rules found")
+	}
+	ids, estimate, err := mailer.NewestThreads(query, rulesTestLimit)
+	if err != nil {
+		return err
+	}
+	if estimate > int64(len(ids)) {
+		fmt.Printf("Checking the newest %d of about %d threads\n", len(ids), estimate)
+	}
+	for _, id := range ids {
+		thread, err := mailer.FetchThread(id)
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0)
+		for _, rule := range mailer.MatchingRules(thread) {
+			names = append(names, rule.Name)
+		}
+		if len(names) == 0 {
+			names = append(names, "-")
+		}
+		fmt.Printf("%s\t%s\t%s\n", id, thread.Subject, strings.Join(names, ", "))
+	}
+	return nil
+}
+
+func queryContacts(account *app.Account, query, importFile string) error {
+	contacts, err := app.LoadContacts(account.Name)
+	if err != nil {
+		return err
+	}
+	if importFile != "" {
+		count, err := contacts.Import(importFile)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Imported %d contacts from %s\n", count, importFile)
+		return contacts.Save()
+	}
+	for _, contact := range contacts.Search(query, 0) {
+		fmt.Printf("%s\t(%d)\n", contact, contact.Count)
+	}
+	return nil
+}
+
+// reauthorize signs the account in again with the scopes granted to its
+// revoked token, unless -scopes asks for a different profile.
+func reauthorize(creds []byte, profile string, account *app.Account) error {
+	scopes, err := app.ProfileScopes(profile)
+	if err != nil {
+		return err
+	}
+	if !isFlagSet("scopes") {
+		if scopes, err = app.SavedScopes(account); err != nil {
+			return err
+		}
+	}
+	return app.FetchToken(creds, scopes, account)
+}
+
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func clearMail(mailer *app.Mailer, opts *app.ClearOptions, dryRun, yes bool) error {
+	query := opts.SearchQuery()
+	if len(opts.Labels) == 0 && query == "" {
+		return fmt.Errorf("clear mode needs labels (-l) or a query (-q/-older)")
+	}
+	capability := app.CapModify
+	if opts.Permanent {
+		capability = app.CapDelete
+	}
+	if err := mailer.Require(capability); err != nil && !dryRun {
+		return err
+	}
+	ids, err := mailer.MatchingMessages(opts.Labels, query)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Matched %d message(s) under labels %v with query %q\n", len(ids), opts.Labels, query)
+	if len(ids) == 0 || dryRun {
+		return nil
+	}
+
+	verb := "move to trash"
+	if opts.Permanent {
+		verb = "PERMANENTLY DELETE"
+	}
+	if !yes && !confirmCount(len(ids), verb) {
+		fmt.Println("Aborted, nothing changed")
+		return nil
+	}
+
+	if err := mailer.ClearMessages(ids, opts.Permanent); err != nil {
+		return err
+	}
+	if opts.Permanent {
+		fmt.Printf("Permanently deleted %d message(s)\n", len(ids))
+	} else {
+		fmt.Printf("Moved %d message(s) to trash, recoverable for 30 days\n", len(ids))
+	}
+	return nil
+}
+
+// confirmCount asks the user to type the number of affected messages.
+func confirmCount(count int, verb string) bool {
+	fmt.Printf("Type %d to %s these messages: ", count, verb)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(answer) == fmt.Sprintf("%d", count)
+}
+
+func runBulk(mailer *app.Mailer, query, action, add, remove string, dryRun, yes, restart bool) error {
+	if query == "" {
+		return fmt.Errorf("bulk mode needs a search query (-q)")
+	}
+	addIDs, err := mailer.LabelIDs(strings.Split(add, ","))
+	if err != nil {
+		return err
+	}
+	removeIDs, err := mailer.LabelIDs(strings.Split(remove, ","))
+	if err != nil {
+		return err
+	}
+	job, err := mailer.NewBulkJob(query, action, addIDs, removeIDs, restart)
+	if err != nil {
+		return err
+	}
+	if job.Resumed {
+		fmt.Printf("Resuming %s job started %s: %d/%d done\n", job.Action, job.Created.Format("2006-01-02 15:04"), job.Done, len(job.IDs))
+	} else {
+		fmt.Printf("Matched %d message(s) for %q\n", len(job.IDs), query)
+	}
+	if len(job.IDs) == 0 || (dryRun && !job.Resumed) {
+		return job.Discard()
+	}
+	if dryRun {
+		return nil
+	}
+	if !yes && (action == "delete" || action == "trash") && !confirmCount(len(job.IDs)-job.Done, action) {
+		fmt.Println("Aborted, progress kept for a later run")
+		return nil
+	}
+	err = mailer.RunBulk(job, func(done, total int) {
+		fmt.Printf("\rProcessed %d/%d", done, total)
+	})
+	fmt.Println()
+	return err
+}
+
+func manageLabels(mailer *app.Mailer, action, name, newName, bg, fg, visibility, format string) error {
+	if action != "list" && name == "" {
+		return fmt.Errorf("labels %s needs a label name (-name)", action)
+	}
+	switch action {
+	case "list":
+		return mailer.ListLabels(format)
+	case "create":
+		label, err := mailer.CreateLabel(name, bg, fg, visibility)
+		if err == nil {
+			fmt.Printf("Created label %s (%s)\n", label.Name, label.Id)
+		}
+		return err
+	case "rename":
+		if newName == "" {
+			return fmt.Errorf("labels rename needs a new name (-newname)")
+		}
+		return mailer.RenameLabel(name, newName)
+	case "color":
+		return mailer.ColorLabel(name, bg, fg)
+	case "visibility":
+		return mailer.SetLabelVisibility(name, visibility)
+	case "delete":
+		return mailer.DeleteLabel(name)
+	}
+	return fmt.Errorf("unknown labels action: %s", action)
+}
+
+func splitList(value string) []string {
+	list := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func manageFilters(mailer *app.Mailer, action, id, file, format string, spec *app.FilterSpec) error {
+	switch action {
+	case "list":
+		specs, err := mailer.ListFilters()
+		if err != nil {
+			return err
+		}
+		if format == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(specs)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tCRITERIA\tACTIONS")
+		for _, spec := range specs {
+			criteria, actions := spec.Summary()
+			fmt.Fprintf(w, "%s\t%s\t%s\n", spec.ID, criteria, actions)
+		}
+		return w.Flush()
+	case "create":
+		specs := []*app.FilterSpec{spec}
+		if file != "" {
+			var err error
+			if specs, err = app.LoadFilterSpecs(file); err != nil {
+				return err
+			}
+		}
+		for _, spec := range specs {
+			created, err := mailer.CreateFilter(spec)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Created filter %s\n", created.ID)
+		}
+		return nil
+	case "delete":
+		if id == "" {
+			return fmt.Errorf("filters delete needs a filter ID (-id)")
+		}
+		return mailer.DeleteFilter(id)
+	}
+	return fmt.Errorf("unknown filters action: %s", action)
+}
+
+func syncFilters(mailer *app.Mailer, action, file string, dryRun, yes bool) error {
+	if file == "" {
+		return fmt.Errorf("filters-sync needs a filters file (-f)")
+	}
+	switch action {
+	case "export":
+		if err := mailer.ExportFilters(file); err != nil {
+			return err
+		}
+		fmt.Printf("Exported filters to %s\n", file)
+		return nil
+	case "list", "sync":
+	default:
+		return fmt.Errorf("unknown filters-sync action: %s, expected list|sync|export", action)
+	}
+
+	desired, err := app.LoadFilterSpecs(file)
+	if err != nil {
+		return err
+	}
+	plan, err := mailer.PlanFilterSync(desired)
+	if err != nil {
+		return err
+	}
+	for _, spec := range plan.Create {
+		criteria, actions := spec.Summary()
+		fmt.Printf("+ create  %s => %s\n", criteria, actions)
+	}
+	for _, spec := range plan.Delete {
+		criteria, actions := spec.Summary()
+		fmt.Printf("- delete  %s => %s (%s)\n", criteria, actions, spec.ID)
+	}
+	fmt.Printf("Plan: %d to create, %d to delete, %d unchanged\n", len(plan.Create), len(plan.Delete), plan.Unchanged)
+	if plan.Empty() || dryRun || action != "sync" {
+		if !plan.Empty() && action != "sync" {
+			fmt.Println("Run with -action sync to apply it")
+		}
+		return nil
+	}
+	if !yes {
+		fmt.Print("Apply this plan? [y/N]: ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.ToLower(strings.TrimSpace(answer)) != "y" {
+			fmt.Println("Aborted, nothing changed")
+			return nil
+		}
+	}
+	if err := mailer.ApplyFilterPlan(plan); err != nil {
+		return err
+	}
+	fmt.Println("Filters in sync")
+	return nil
+}
+
+func manageThreads(mailer *app.Mailer, mode, action, id, query, at string) error {
+	state, err := app.LoadThreadState(mailer.Account)
+	if err != nil {
+		return err
+	}
+	if action == "list" {
+		if mode == "mute" {
+			for threadID, subject := range state.Muted {
+				fmt.Printf("%s\t%s\n", threadID, subject)
+			}
+			return nil
+		}
+		for _, snooze := range state.Snoozed {
+			if !app.SameAccount(snooze.Account, mailer.Account) {
+				continue
+			}
+			fmt.Printf("%s\t%s\t%s\n", snooze.ThreadID, snooze.Until.Format(app.SendTimeLayout), snooze.Subject)
+		}
+		return nil
+	}
+
+	ids := make([]string, 0)
+	if id != "" {
+		ids = append(ids, id)
+	}
+	if query != "" {
+		matched, err := mailer.MatchingThreads(query)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, matched...)
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("%s %s needs a thread ID (-id) or query (-q)", mode, action)
+	}
+	var until time.Time
+	if mode == "snooze" && action == "add" {
+		if until, err = app.ParseSendTime(at); err != nil {
+			return err
+		}
+	}
+
+	for _, threadID := range ids {
+		switch {
+		case action == "add" && mode == "mute":
+			subject, _ := mailer.ThreadSubject(threadID)
+			err = mailer.Mute(threadID, subject)
+		case action == "add":
+			subject, _ := mailer.ThreadSubject(threadID)
+			err = mailer.Snooze(threadID, subject, until)
+		case action == "remove" && mode == "mute":
+			err = mailer.Unmute(threadID)
+		case action == "remove":
+			err = mailer.Unsnooze(threadID)
+		default:
+			return fmt.Errorf("unknown %s action: %s", mode, action)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Updated %d thread(s)\n", len(ids))
+	return nil
+}
+
+func applyLabels(mailer *app.Mailer, query, add, remove string) error {
+	if query == "" {
+		return fmt.Errorf("label mode needs a search query (-q)")
+	}
+	addIDs, err := mailer.LabelIDs(strings.Split(add, ","))
+	if err != nil {
+		return err
+	}
+	removeIDs, err := mailer.LabelIDs(strings.Split(remove, ","))
+	if err != nil {
+		return err
+	}
+	if len(addIDs) == 0 && len(removeIDs) == 0 {
+		return fmt.Errorf("label mode needs -add or -remove")
+	}
+	count, err := mailer.LabelQuery(query, addIDs, removeIDs)
+	fmt.Printf("Updated labels on %d message(s)\n", count)
+	return err
+}
+
+func scheduleMail(mailer *app.Mailer, params *app.ComposeParams, at string) error {
+	sendAt, err := app.ParseSendTime(at)
+	if err != nil {
+		return err
+	}
+	item, err := mailer.QueueAt(params, "new", sendAt)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Scheduled %s for %s\n", item.ID, sendAt.Format(app.SendTimeLayout))
+	return nil
+}
+
+func manageOutbox(mailer *app.Mailer, action, id string) error {
+	switch action {
+	case "list":
+		items, err := app.ListOutbox(mailer.Account)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tTO\tSUBJECT\tSEND AT\tSTATUS")
+		for _, item := range items {
+			status := "queued"
+			if item.Failed {
+				status = "failed: " + item.LastError
+			} else if item.Attempts > 0 {
+				status = fmt.Sprintf("retry %d at %s", item.Attempts, item.NextAttempt.Format("2006-01-02 15:04:05"))
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", item.ID, item.Params.To, item.Params.Subject, item.SendAt.Format("2006-01-02 15:04:05"), status)
+		}
+		return w.Flush()
+	case "flush":
+		ids := make([]string, 0)
+		if id != "" {
+			ids = append(ids, id)
+		}
+		sent, err := mailer.FlushOutbox(true, ids...)
+		fmt.Printf("Sent %d mail(s)\n", sent)
+		return err
+	case "cancel":
+		_, err := app.CancelOutbox(mailer.Account, id)
+		return err
+	}
+	return fmt.Errorf("unknown outbox action: %s", action)
+}
+
 func readMailFromFile(filePath string) string {
 	data, err := ioutil.ReadFile(filePath)
 	if err != nil {
@@ -0,0 +1,108 @@
+package render
+
+import (
+	"fmt"
+
+	"github.com/ajithnn/thanthi/app"
+	"github.com/ajithnn/thanthi/logger"
+	"github.com/jroimartin/gocui"
+)
+
+// accountNames lists the accounts configured in config.json, the default one first.
+func (r *Render) accountNames() []string {
+	if r.MailHandler.Config == nil {
+		return []string{app.DefaultAccount}
+	}
+	return r.MailHandler.Config.AccountNames()
+}
+
+func (r *Render) openAccountSwitcher(g *gocui.Gui, v *gocui.View) error {
+	if v != nil && v.Name() == "compose" {
+		return nil
+	}
+	names := r.accountNames()
+	if len(names) < 2 || r.OpenAccount == nil {
+		r.setStatus("No other accounts, add them under accounts in config.json")
+		return nil
+	}
+	maxX, maxY := g.Size()
+	view, err := g.SetView("accounts", maxX/2-25, maxY/4, maxX/2+25, maxY/4+len(names)+1)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	view.Clear()
+	view.Title = "Accounts - Enter: switch, CTRL+Q: close"
+	view.Highlight = true
+	view.SelBgColor = gocui.ColorWhite
+	view.SelFgColor = gocui.ColorRed
+	for index, name := range names {
+		mark := " "
+		if name == r.MailHandler.Account {
+			mark = "*"
+			view.SetCursor(0, index)
+		}
+		fmt.Fprintf(view, "%s %s\n", mark, name)
+	}
+	g.SetViewOnTop("accounts")
+	_, err = g.SetCurrentView("accounts")
+	return err
+}
+
+func (r *Render) moveAccountCursor(delta int) func(*gocui.Gui, *gocui.View) error {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		_, cy := v.Cursor()
+		if cy+delta < 0 || cy+delta >= len(r.accountNames()) {
+			return nil
+		}
+		return v.SetCursor(0, cy+delta)
+	}
+}
+
+// switchAccount makes the account under the cursor the active one. Mailers
+// are kept once signed in, so each account returns to the page it was on.
+func (r *Render) switchAccount(g *gocui.Gui, v *gocui.View) error {
+	_, cy := v.Cursor()
+	names := r.accountNames()
+	if cy >= len(names) {
+		return nil
+	}
+	name := names[cy]
+	if err := r.closeAccountSwitcher(g, v); err != nil {
+		return err
+	}
+	if name == r.MailHandler.Account {
+		return nil
+	}
+
+	r.mailers[r.MailHandler.Account] = r.MailHandler
+	mailer, loaded := r.mailers[name]
+	if !loaded {
+		r.setStatus("Signing in " + name + "...")
+		var err error
+		if mailer, err = r.OpenAccount(name); err != nil {
+			logger.NewLogger().Infof("Render#SwitchAccount: Opening %s failed %v", name, err)
+			r.setStatus("Unable to open " + name + ": " + err.Error())
+			return nil
+		}
+		r.mailers[name] = mailer
+	}
+
+	r.MailHandler.OnReauth = nil
+	r.MailHandler = mailer
+	r.MailHandler.OnReauth = r.promptReauth
+	r.clearSelection()
+	if !loaded {
+		// Accounts opened before already have their outbox timer.
+		r.scheduleOutbox(mailer)
+		return r.initPage(g)
+	}
+	return r.reloadPage(g)
+}
+
+func (r *Render) closeAccountSwitcher(g *gocui.Gui, v *gocui.View) error {
+	if err := g.DeleteView("accounts"); err != nil {
+		return err
+	}
+	_, err := g.SetCurrentView("side")
+	return err
+}
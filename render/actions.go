@@ -0,0 +1,219 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ajithnn/thanthi/app"
+	"github.com/ajithnn/thanthi/logger"
+	"github.com/jroimartin/gocui"
+)
+
+func (r *Render) currentThread() *app.Thread {
+	_, cy := r.Views[SIDE].Cursor()
+	if cy >= len(r.MailHandler.Threads) {
+		return nil
+	}
+	return r.MailHandler.Threads[cy]
+}
+
+// selectedThreads returns the selected threads of the current page.
+func (r *Render) selectedThreads() []*app.Thread {
+	threads := make([]*app.Thread, 0)
+	for _, thread := range r.MailHandler.Threads {
+		if r.selected[thread.ID] {
+			threads = append(threads, thread)
+		}
+	}
+	return threads
+}
+
+// applyThreadAction runs action on the thread under the side view cursor and reloads the page.
+func (r *Render) applyThreadAction(g *gocui.Gui, name string, action func(*app.Thread) error) error {
+	thread := r.currentThread()
+	if thread == nil {
+		return nil
+	}
+	if err := action(thread); err != nil {
+		logger.NewLogger().Infof("Render#%s: Failed %v", name, err)
+		r.setStatus(name + " failed: " + err.Error())
+		return nil
+	}
+	g.Update(r.reloadPage)
+	return nil
+}
+
+// applySelectionAction applies the bulk action to all selected threads in one
+// batch request, falling back to single on the thread under the cursor.
+func (r *Render) applySelectionAction(g *gocui.Gui, name, bulk string, single func(*app.Thread) error) error {
+	threads := r.selectedThreads()
+	if len(threads) == 0 {
+		return r.applyThreadAction(g, name, single)
+	}
+	if err := r.MailHandler.ApplyToThreads(bulk, threads, nil, nil); err != nil {
+		logger.NewLogger().Infof("Render#%s: Failed %v", name, err)
+		r.setStatus(name + " failed: " + err.Error())
+		return nil
+	}
+	r.clearSelection()
+	g.Update(r.reloadPage)
+	return nil
+}
+
+func (r *Render) archiveWrapper(g *gocui.Gui) error {
+	return r.archive(g, r.Views[MAIN])
+}
+
+func (r *Render) archive(g *gocui.Gui, v *gocui.View) error {
+	return r.applySelectionAction(g, "Archive", "archive", r.MailHandler.Archive)
+}
+
+func (r *Render) trashWrapper(g *gocui.Gui) error {
+	return r.trash(g, r.Views[MAIN])
+}
+
+func (r *Render) trash(g *gocui.Gui, v *gocui.View) error {
+	return r.applySelectionAction(g, "Trash", "trash", r.MailHandler.Trash)
+}
+
+func (r *Render) untrashWrapper(g *gocui.Gui) error {
+	return r.untrash(g, r.Views[MAIN])
+}
+
+func (r *Render) untrash(g *gocui.Gui, v *gocui.View) error {
+	return r.applyThreadAction(g, "Untrash", r.MailHandler.Untrash)
+}
+
+func (r *Render) deleteWrapper(g *gocui.Gui) error {
+	return r.deleteThread(g, r.Views[MAIN])
+}
+
+func (r *Render) deleteThread(g *gocui.Gui, v *gocui.View) error {
+	question := ""
+	if threads := r.selectedThreads(); len(threads) > 0 {
+		question = fmt.Sprintf("Permanently delete %d selected threads?", len(threads))
+	} else if thread := r.currentThread(); thread != nil {
+		question = fmt.Sprintf("Permanently delete \"%s\"?", thread.Subject)
+	} else {
+		return nil
+	}
+	return r.renderConfirm(g, question, func(g *gocui.Gui) error {
+		return r.applySelectionAction(g, "Delete", "delete", r.MailHandler.Delete)
+	})
+}
+
+// renderConfirm asks a yes/no question and runs onConfirm when the answer is y.
+func (r *Render) renderConfirm(g *gocui.Gui, question string, onConfirm func(*gocui.Gui) error) error {
+	maxX, maxY := g.Size()
+	width := len(question)/2 + 4
+	if width < 20 {
+		width = 20
+	}
+	view, err := g.SetView("confirm", maxX/2-width, maxY/2-2, maxX/2+width, maxY/2+2)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	view.Clear()
+	view.Title = "Confirm"
+	fmt.Fprintf(view, "%s\n\n(y)es / (n)o\n", question)
+	if current := g.CurrentView(); current != nil && current.Name() != "confirm" {
+		r.confirmReturn = current.Name()
+	}
+	r.onConfirm = onConfirm
+	g.SetViewOnTop("confirm")
+	_, err = g.SetCurrentView("confirm")
+	return err
+}
+
+func (r *Render) answerConfirm(confirmed bool) func(*gocui.Gui, *gocui.View) error {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		if err := g.DeleteView("confirm"); err != nil {
+			return err
+		}
+		if r.confirmReturn != "" {
+			g.SetCurrentView(r.confirmReturn)
+		}
+		onConfirm := r.onConfirm
+		r.onConfirm = nil
+		if confirmed && onConfirm != nil {
+			return onConfirm(g)
+		}
+		return nil
+	}
+}
+
+// targetThreads returns the selected threads, or the thread under the cursor when nothing is selected.
+func (r *Render) targetThreads() []*app.Thread {
+	threads := r.selectedThreads()
+	if len(threads) == 0 {
+		if thread := r.currentThread(); thread != nil {
+			threads = append(threads, thread)
+		}
+	}
+	return threads
+}
+
+func (r *Render) mute(g *gocui.Gui, v *gocui.View) error {
+	threads := r.targetThreads()
+	for _, thread := range threads {
+		if err := r.MailHandler.Mute(thread.ID, thread.Subject); err != nil {
+			r.setStatus("Mute failed: " + err.Error())
+			return nil
+		}
+	}
+	if len(threads) > 0 {
+		r.clearSelection()
+		g.Update(r.reloadPage)
+	}
+	return nil
+}
+
+func (r *Render) openSnooze(g *gocui.Gui, v *gocui.View) error {
+	if len(r.targetThreads()) == 0 {
+		return nil
+	}
+	maxX, maxY := g.Size()
+	view, err := g.SetView("snooze", maxX/2-20, maxY/2-1, maxX/2+20, maxY/2+1)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	view.Clear()
+	view.Title = "Snooze until (YYYY-MM-DD HH:MM)"
+	view.Editable = true
+	tomorrow := time.Now().AddDate(0, 0, 1)
+	fmt.Fprint(view, time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 9, 0, 0, 0, time.Local).Format(app.SendTimeLayout))
+	view.SetCursor(len(app.SendTimeLayout), 0)
+	g.SetViewOnTop("snooze")
+	_, err = g.SetCurrentView("snooze")
+	return err
+}
+
+func (r *Render) snooze(g *gocui.Gui, v *gocui.View) error {
+	until, err := app.ParseSendTime(strings.TrimSpace(v.Buffer()))
+	if err != nil {
+		v.Title = err.Error()
+		return nil
+	}
+	for _, thread := range r.targetThreads() {
+		if err := r.MailHandler.Snooze(thread.ID, thread.Subject, until); err != nil {
+			v.Title = "Snooze failed: " + err.Error()
+			return nil
+		}
+	}
+	if err := g.DeleteView("snooze"); err != nil {
+		return err
+	}
+	r.clearSelection()
+	r.setStatus("Snoozed until " + until.Format(app.SendTimeLayout))
+	g.Update(r.reloadPage)
+	return nil
+}
+
+func (r *Render) closeSnooze(g *gocui.Gui, v *gocui.View) error {
+	if err := g.DeleteView("snooze"); err != nil {
+		return err
+	}
+	_, err := g.SetCurrentView("side")
+	return err
+}
@@ -0,0 +1,108 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ajithnn/thanthi/logger"
+	"github.com/jroimartin/gocui"
+)
+
+// viewWriter appends to a view from outside the main loop.
+type viewWriter struct {
+	g    *gocui.Gui
+	name string
+}
+
+func (w *viewWriter) Write(p []byte) (int, error) {
+	text := string(p)
+	w.g.Update(func(g *gocui.Gui) error {
+		if view, err := g.View(w.name); err == nil {
+			fmt.Fprint(view, text)
+		}
+		return nil
+	})
+	return len(p), nil
+}
+
+// promptReauth offers to sign in again once the saved sign-in stops working.
+func (r *Render) promptReauth() {
+	r.Handler.Update(func(g *gocui.Gui) error {
+		return r.renderConfirm(g, "The sign-in was revoked or has expired. Sign in again in the browser?", r.reauthorize)
+	})
+}
+
+// reauthorize shows the sign-in link along with a field to paste the
+// redirected address or code into, for hosts where the browser runs elsewhere.
+func (r *Render) reauthorize(g *gocui.Gui) error {
+	maxX, maxY := g.Size()
+	view, err := g.SetView("reauth", maxX/2-40, maxY/2-6, maxX/2+40, maxY/2+3)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	view.Clear()
+	view.Title = "Sign in (CTRL+Q to close)"
+	view.Wrap = true
+	paste, err := g.SetView("reauth-paste", maxX/2-40, maxY/2+3, maxX/2+40, maxY/2+5)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	paste.Clear()
+	paste.Title = "Paste the redirected address or code, Enter to submit"
+	paste.Editable = true
+	g.SetViewOnTop("reauth")
+	g.SetViewOnTop("reauth-paste")
+	if _, err := g.SetCurrentView("reauth-paste"); err != nil {
+		return err
+	}
+	in, pasted := io.Pipe()
+	r.reauthPaste = pasted
+	go func() {
+		err := r.MailHandler.Reauthorize(in, &viewWriter{g: g, name: "reauth"})
+		g.Update(func(g *gocui.Gui) error {
+			_, viewErr := g.View("reauth")
+			if viewErr == nil {
+				r.closeReauth(g, nil)
+			}
+			if err != nil {
+				logger.NewLogger().Infof("Render#Reauthorize: Failed %v", err)
+				if viewErr != nil {
+					// Closed by the user, who does not want to be asked again.
+					r.setStatus("Sign-in failed: " + err.Error())
+					return nil
+				}
+				return r.renderConfirm(g, "Sign-in failed: "+err.Error()+". Try again?", r.reauthorize)
+			}
+			r.setStatus("Signed in again")
+			return r.reloadPage(g)
+		})
+	}()
+	return nil
+}
+
+// submitReauthPaste hands the pasted line to the running sign-in.
+func (r *Render) submitReauthPaste(g *gocui.Gui, v *gocui.View) error {
+	line := strings.TrimSpace(v.Buffer())
+	if line == "" || r.reauthPaste == nil {
+		return nil
+	}
+	v.Clear()
+	v.SetCursor(0, 0)
+	v.Title = "Signing in..."
+	go io.WriteString(r.reauthPaste, line+"\n")
+	return nil
+}
+
+func (r *Render) closeReauth(g *gocui.Gui, v *gocui.View) error {
+	if r.reauthPaste != nil {
+		r.reauthPaste.Close()
+		r.reauthPaste = nil
+	}
+	g.DeleteView("reauth-paste")
+	if err := g.DeleteView("reauth"); err != nil {
+		return err
+	}
+	_, err := g.SetCurrentView("side")
+	return err
+}
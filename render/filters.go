@@ -0,0 +1,60 @@
+package render
+
+import (
+	"fmt"
+
+	"github.com/ajithnn/thanthi/app"
+	"github.com/jroimartin/gocui"
+)
+
+func (r *Render) filterWrapper(g *gocui.Gui) error {
+	return r.openFilterForm(g, r.Views[MAIN])
+}
+
+// openFilterForm opens a YAML form for a new Gmail filter pre-filled from
+// the last message of the thread under the cursor.
+func (r *Render) openFilterForm(g *gocui.Gui, v *gocui.View) error {
+	thread := r.currentThread()
+	if thread == nil || len(thread.Messages) == 0 {
+		return nil
+	}
+	spec := app.FilterFromMessage(thread.Messages[len(thread.Messages)-1], thread.Subject)
+
+	maxX, maxY := g.Size()
+	view, err := g.SetView("filter", maxX/6, maxY/6, maxX-maxX/6, maxY-maxY/6)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	view.Clear()
+	view.Title = "New filter - CTRL+S: create, CTRL+Q: cancel"
+	view.Editable = true
+	fmt.Fprint(view, spec.Template())
+	view.SetCursor(0, 0)
+	g.SetViewOnTop("filter")
+	_, err = g.SetCurrentView("filter")
+	return err
+}
+
+func (r *Render) createFilter(g *gocui.Gui, v *gocui.View) error {
+	specs, err := app.ParseFilterSpecs([]byte(v.Buffer()))
+	if err != nil {
+		v.Title = "Invalid filter: " + err.Error()
+		return nil
+	}
+	for index, spec := range specs {
+		if _, err := r.MailHandler.CreateFilter(spec); err != nil {
+			v.Title = fmt.Sprintf("Created %d of %d filter(s), then failed: %v", index, len(specs), err)
+			return nil
+		}
+	}
+	r.setStatus(fmt.Sprintf("Created %d filter(s)", len(specs)))
+	return r.closeFilterForm(g, v)
+}
+
+func (r *Render) closeFilterForm(g *gocui.Gui, v *gocui.View) error {
+	if err := g.DeleteView("filter"); err != nil {
+		return err
+	}
+	_, err := g.SetCurrentView("side")
+	return err
+}
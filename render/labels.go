@@ -0,0 +1,180 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ajithnn/thanthi/app"
+	"github.com/jroimartin/gocui"
+	"google.golang.org/api/gmail/v1"
+)
+
+// labelPicker is the state of the label popup opened on the selected threads,
+// or the thread under the cursor when nothing is selected.
+type labelPicker struct {
+	threads []*app.Thread
+	labels  []*gmail.Label
+	matches []*gmail.Label
+	changed bool
+}
+
+func (r *Render) toggleStar(g *gocui.Gui, v *gocui.View) error {
+	return r.applyThreadAction(g, "Star", func(thread *app.Thread) error {
+		return r.MailHandler.ToggleLabel(thread, "STARRED")
+	})
+}
+
+func (r *Render) toggleImportant(g *gocui.Gui, v *gocui.View) error {
+	return r.applyThreadAction(g, "Important", func(thread *app.Thread) error {
+		return r.MailHandler.ToggleLabel(thread, "IMPORTANT")
+	})
+}
+
+func (r *Render) openLabelPicker(g *gocui.Gui, v *gocui.View) error {
+	threads := r.selectedThreads()
+	if len(threads) == 0 {
+		thread := r.currentThread()
+		if thread == nil {
+			return nil
+		}
+		threads = append(threads, thread)
+	}
+	labels, err := r.MailHandler.FetchLabels()
+	if err != nil {
+		r.setStatus("Unable to load labels: " + err.Error())
+		return nil
+	}
+	r.picker = &labelPicker{threads: threads, labels: labels}
+
+	maxX, maxY := g.Size()
+	filter, err := g.SetView("label-filter", maxX/2-25, maxY/4-3, maxX/2+25, maxY/4-1)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	filter.Title = "Labels - type to filter, Enter: toggle, CTRL+Q: close"
+	filter.Editable = true
+	filter.Editor = gocui.EditorFunc(func(v *gocui.View, key gocui.Key, ch rune, mod gocui.Modifier) {
+		gocui.DefaultEditor.Edit(v, key, ch, mod)
+		r.refreshLabelList(g)
+	})
+
+	list, err := g.SetView("label-list", maxX/2-25, maxY/4-1, maxX/2+25, maxY*3/4)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	list.Highlight = true
+	list.SelBgColor = gocui.ColorWhite
+	list.SelFgColor = gocui.ColorRed
+
+	r.refreshLabelList(g)
+	g.SetViewOnTop("label-list")
+	g.SetViewOnTop("label-filter")
+	_, err = g.SetCurrentView("label-filter")
+	return err
+}
+
+func (r *Render) refreshLabelList(g *gocui.Gui) {
+	filter, err := g.View("label-filter")
+	if err != nil {
+		return
+	}
+	list, err := g.View("label-list")
+	if err != nil {
+		return
+	}
+	pattern := strings.TrimSpace(filter.Buffer())
+	r.picker.matches = make([]*gmail.Label, 0)
+	for _, label := range r.picker.labels {
+		if app.FuzzyMatch(pattern, label.Name) {
+			r.picker.matches = append(r.picker.matches, label)
+		}
+	}
+
+	list.Clear()
+	_, cy := list.Cursor()
+	if cy >= len(r.picker.matches) {
+		list.SetCursor(0, 0)
+		list.SetOrigin(0, 0)
+	}
+	for _, label := range r.picker.matches {
+		mark := " "
+		switch count := r.picker.labelled(label.Id); {
+		case count == len(r.picker.threads):
+			mark = "x"
+		case count > 0:
+			mark = "-"
+		}
+		fmt.Fprintf(list, "[%s] %s\n", mark, label.Name)
+	}
+}
+
+// labelled counts the picker's threads carrying the label.
+func (p *labelPicker) labelled(labelID string) int {
+	count := 0
+	for _, thread := range p.threads {
+		if thread.HasLabel(labelID) {
+			count++
+		}
+	}
+	return count
+}
+
+func (r *Render) moveLabelCursor(delta int) func(*gocui.Gui, *gocui.View) error {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		list, err := g.View("label-list")
+		if err != nil {
+			return err
+		}
+		_, cy := list.Cursor()
+		_, oy := list.Origin()
+		if cy+oy+delta < 0 || cy+oy+delta >= len(r.picker.matches) {
+			return nil
+		}
+		if delta > 0 {
+			return cursorDown(g, list)
+		}
+		return cursorUp(g, list)
+	}
+}
+
+func (r *Render) toggleSelectedLabel(g *gocui.Gui, v *gocui.View) error {
+	list, err := g.View("label-list")
+	if err != nil {
+		return err
+	}
+	_, cy := list.Cursor()
+	_, oy := list.Origin()
+	if cy+oy >= len(r.picker.matches) {
+		return nil
+	}
+	label := r.picker.matches[cy+oy]
+	switch {
+	case len(r.picker.threads) == 1:
+		err = r.MailHandler.ToggleLabel(r.picker.threads[0], label.Id)
+	case r.picker.labelled(label.Id) == len(r.picker.threads):
+		err = r.MailHandler.ApplyToThreads("label", r.picker.threads, nil, []string{label.Id})
+	default:
+		err = r.MailHandler.ApplyToThreads("label", r.picker.threads, []string{label.Id}, nil)
+	}
+	if err != nil {
+		filter, _ := g.View("label-filter")
+		filter.Title = "Toggle failed: " + err.Error()
+		return nil
+	}
+	r.picker.changed = true
+	r.refreshLabelList(g)
+	return nil
+}
+
+func (r *Render) closeLabelPicker(g *gocui.Gui, v *gocui.View) error {
+	g.DeleteView("label-filter")
+	g.DeleteView("label-list")
+	changed := r.picker != nil && r.picker.changed
+	r.picker = nil
+	if changed {
+		g.Update(r.reloadPage)
+		return nil
+	}
+	_, err := g.SetCurrentView("side")
+	return err
+}
@@ -0,0 +1,195 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ajithnn/thanthi/app"
+	"github.com/ajithnn/thanthi/logger"
+	"github.com/jroimartin/gocui"
+)
+
+// setStatus shows msg in the header without moving focus away from the current view.
+func (r *Render) setStatus(msg string) {
+	if len(r.Views) <= HEADER {
+		return
+	}
+	r.Views[HEADER].Clear()
+	fmt.Fprintf(r.Views[HEADER], "\t\t\t\t\t\t\t\t\t\t\t\t\t\t%s", msg)
+}
+
+// scheduleOutbox arranges for the outbox of mailer to be flushed when its
+// next mail is due, replacing the timer set before for that account. The
+// timer keeps the mailer, so mail is sent from the account that queued it
+// even after switching to another one.
+func (r *Render) scheduleOutbox(mailer *app.Mailer) {
+	if timer, ok := r.outboxTimers[mailer.Account]; ok {
+		timer.Stop()
+		delete(r.outboxTimers, mailer.Account)
+	}
+	next, ok := app.NextOutboxDue(mailer.Account)
+	if !ok {
+		return
+	}
+	r.outboxTimers[mailer.Account] = time.AfterFunc(time.Until(next)+100*time.Millisecond, func() {
+		// Sending waits on the network, so it stays off the main loop.
+		sent, err := mailer.FlushOutbox(false)
+		r.Handler.Update(func(g *gocui.Gui) error {
+			return r.outboxFlushed(g, mailer, sent, err)
+		})
+	})
+}
+
+// outboxFlushed reports a flush of the outbox of mailer and schedules the next one.
+func (r *Render) outboxFlushed(g *gocui.Gui, mailer *app.Mailer, sent int, err error) error {
+	if err != nil {
+		logger.NewLogger().Infof("Render#FlushOutbox: Flush of %s Failed %v", mailer.Account, err)
+	}
+	if sent > 0 && mailer == r.MailHandler {
+		r.setStatus(fmt.Sprintf("Sent %d mail(s)", sent))
+	} else if sent > 0 {
+		r.setStatus(fmt.Sprintf("Sent %d mail(s) from %s", sent, mailer.Account))
+	}
+	r.refreshOutbox(g)
+	r.scheduleOutbox(mailer)
+	return nil
+}
+
+func (r *Render) undoSend(g *gocui.Gui, v *gocui.View) error {
+	if r.lastQueued == "" {
+		return nil
+	}
+	item, err := app.CancelOutbox(r.MailHandler.Account, r.lastQueued)
+	if err != nil {
+		r.setStatus("Nothing to undo: " + err.Error())
+		return nil
+	}
+	r.lastQueued = ""
+	r.setStatus("Send cancelled")
+	r.Params = &item.Params
+	r.refreshOutbox(g)
+	g.Update(r.renderCompose)
+	return nil
+}
+
+func (r *Render) toggleOutbox(g *gocui.Gui, v *gocui.View) error {
+	if _, err := g.View("outbox"); err == nil {
+		if err := g.DeleteView("outbox"); err != nil {
+			return err
+		}
+		_, err := g.SetCurrentView("side")
+		return err
+	}
+	maxX, maxY := g.Size()
+	view, err := g.SetView("outbox", maxX/6, maxY/6, maxX-maxX/6, maxY-maxY/6)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	view.Title = "Outbox - s: send now, c: cancel, CTRL+O: close"
+	view.Highlight = true
+	view.SelBgColor = gocui.ColorWhite
+	view.SelFgColor = gocui.ColorRed
+	r.refreshOutbox(g)
+	g.SetViewOnTop("outbox")
+	_, err = g.SetCurrentView("outbox")
+	return err
+}
+
+func (r *Render) refreshOutbox(g *gocui.Gui) {
+	view, err := g.View("outbox")
+	if err != nil {
+		return
+	}
+	view.Clear()
+	r.outbox, err = app.ListOutbox(r.MailHandler.Account)
+	if err != nil {
+		fmt.Fprintf(view, "Unable to read outbox: %v\n", err)
+		return
+	}
+	if len(r.outbox) == 0 {
+		fmt.Fprintln(view, "-----Outbox Empty----")
+		return
+	}
+	for _, item := range r.outbox {
+		state := "due " + item.SendAt.Format("2006-01-02 15:04:05")
+		if item.Failed {
+			state = "failed: " + item.LastError
+		} else if item.Attempts > 0 {
+			state = fmt.Sprintf("retry %d at %s", item.Attempts, item.NextAttempt.Format("15:04:05"))
+		}
+		fmt.Fprintf(view, "%-30.30s %-40.40s %s\n", item.Params.To, item.Params.Subject, state)
+	}
+}
+
+func (r *Render) outboxItem(v *gocui.View) *app.OutboxItem {
+	_, cy := v.Cursor()
+	_, oy := v.Origin()
+	if cy+oy >= len(r.outbox) {
+		return nil
+	}
+	return r.outbox[cy+oy]
+}
+
+func (r *Render) sendOutboxItem(g *gocui.Gui, v *gocui.View) error {
+	item := r.outboxItem(v)
+	if item == nil {
+		return nil
+	}
+	if _, err := r.MailHandler.FlushOutbox(true, item.ID); err != nil {
+		r.setStatus("Send failed: " + err.Error())
+	}
+	r.refreshOutbox(g)
+	return nil
+}
+
+func (r *Render) cancelOutboxItem(g *gocui.Gui, v *gocui.View) error {
+	item := r.outboxItem(v)
+	if item == nil {
+		return nil
+	}
+	if _, err := app.CancelOutbox(r.MailHandler.Account, item.ID); err != nil {
+		r.setStatus("Cancel failed: " + err.Error())
+	}
+	r.refreshOutbox(g)
+	return nil
+}
+
+func (r *Render) toggleSchedule(g *gocui.Gui, v *gocui.View) error {
+	if _, err := g.View("schedule"); err == nil {
+		if err := g.DeleteView("schedule"); err != nil {
+			return err
+		}
+		_, err := g.SetCurrentView("compose")
+		return err
+	}
+	maxX, maxY := g.Size()
+	view, err := g.SetView("schedule", maxX/2-20, maxY/2-1, maxX/2+20, maxY/2+1)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	view.Title = "Send at (YYYY-MM-DD HH:MM)"
+	view.Editable = true
+	tomorrow := time.Now().AddDate(0, 0, 1)
+	fmt.Fprint(view, time.Date(tomorrow.Year(), tomorrow.Month(), tomorrow.Day(), 9, 0, 0, 0, time.Local).Format(app.SendTimeLayout))
+	view.SetCursor(len(app.SendTimeLayout), 0)
+	g.SetViewOnTop("schedule")
+	_, err = g.SetCurrentView("schedule")
+	return err
+}
+
+func (r *Render) scheduleMail(g *gocui.Gui, v *gocui.View) error {
+	at, err := app.ParseSendTime(strings.TrimSpace(v.Buffer()))
+	if err != nil {
+		v.Title = err.Error()
+		return nil
+	}
+	if err := g.DeleteView("schedule"); err != nil {
+		return err
+	}
+	compose, err := g.SetCurrentView("compose")
+	if err != nil {
+		return err
+	}
+	return r.queueMail(g, compose, at)
+}
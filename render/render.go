@@ -2,7 +2,9 @@ package render
 
 import (
 	"fmt"
+	"io"
 	"strings"
+	"time"
 
 	"github.com/ajithnn/thanthi/app"
 	"github.com/ajithnn/thanthi/logger"
@@ -22,6 +24,31 @@ type Render struct {
 	Params      *app.ComposeParams
 	ViewButtons map[string][]string
 	ButtonIndex int
+	// OpenAccount signs in another configured account for the account switcher.
+	OpenAccount func(name string) (*app.Mailer, error)
+
+	completion      *completion
+	confirmExternal bool
+	lastQueued      string
+	outbox          []*app.OutboxItem
+	onConfirm       func(*gocui.Gui) error
+	confirmReturn   string
+	picker          *labelPicker
+	selected        map[string]bool
+	mailers         map[string]*app.Mailer
+	outboxTimers    map[string]*time.Timer
+	reauthPaste     *io.PipeWriter
+}
+
+// completion tracks repeated Tab presses on an address line so they cycle through matches.
+type completion struct {
+	line    int
+	start   int
+	end     int
+	matches []*app.Contact
+	index   int
+	// text is the line as the last completion left it.
+	text string
 }
 
 func NewRenderer(mailer *app.Mailer) (*Render, error) {
@@ -30,18 +57,27 @@ func NewRenderer(mailer *app.Mailer) (*Render, error) {
 		logger.NewLogger().Fatalf("NewRenderer#NewGui: %v", err)
 		return &Render{}, err
 	}
-	return &Render{g, mailer, make([]*gocui.View, 0), &app.ComposeParams{}, make(map[string][]string), 0}, nil
+	return &Render{
+		Handler:      g,
+		MailHandler:  mailer,
+		Views:        make([]*gocui.View, 0),
+		Params:       &app.ComposeParams{},
+		ViewButtons:  make(map[string][]string),
+		selected:     make(map[string]bool),
+		mailers:      make(map[string]*app.Mailer),
+		outboxTimers: make(map[string]*time.Timer),
+	}, nil
 }
 
 func (r *Render) setParams(mode, to, bcc, cc, sub, body string) {
 	r.Params = &app.ComposeParams{
-		mode,
-		to,
-		bcc,
-		cc,
-		sub,
-		body,
-		"",
+		Mode:    mode,
+		From:    r.MailHandler.User,
+		To:      to,
+		Bcc:     bcc,
+		Cc:      cc,
+		Subject: sub,
+		Body:    body,
 	}
 }
 
@@ -53,6 +89,8 @@ func (r *Render) Show() error {
 		return err
 	}
 
+	r.MailHandler.OnReauth = r.promptReauth
+	r.scheduleOutbox(r.MailHandler)
 	if err := r.Handler.MainLoop(); err != nil && err != gocui.ErrQuit {
 		logger.NewLogger().Fatalf("Render#Show: Main loop failed %v", err)
 		return err
@@ -83,6 +121,7 @@ func (r *Render) loadMail(g *gocui.Gui, v *gocui.View) error {
 
 func (r *Render) nextPage(g *gocui.Gui) error {
 
+	r.clearSelection()
 	r.MailHandler.ListMail("next")
 	r.renderHeader(g, "Messages")
 
@@ -101,6 +140,7 @@ func (r *Render) nextPage(g *gocui.Gui) error {
 
 func (r *Render) prevPage(g *gocui.Gui) error {
 
+	r.clearSelection()
 	r.MailHandler.ListMail("prev")
 	r.renderHeader(g, "Messages")
 
@@ -117,6 +157,7 @@ func (r *Render) prevPage(g *gocui.Gui) error {
 }
 
 func (r *Render) initPage(g *gocui.Gui) error {
+	r.clearSelection()
 	r.MailHandler.ListMail("init")
 	r.renderHeader(g, "Messages")
 
@@ -149,8 +190,15 @@ func (r *Render) reloadPage(g *gocui.Gui) error {
 }
 
 func (r *Render) sendMail(g *gocui.Gui, v *gocui.View) error {
+	return r.queueMail(g, v, time.Time{})
+}
+
+// queueMail reads the compose view into r.Params and queues it in the outbox,
+// either after the undo delay or at the given time when scheduling.
+func (r *Render) queueMail(g *gocui.Gui, v *gocui.View, at time.Time) error {
 	var replyID string
 	lines := v.BufferLines()
+	r.Params.Body = ""
 	for index, line := range lines {
 		switch index {
 		case 0:
@@ -166,32 +214,173 @@ func (r *Render) sendMail(g *gocui.Gui, v *gocui.View) error {
 			r.Params.Body += line + "\n"
 		}
 	}
+
+	if err := app.ValidateRecipients(r.Params); err != nil {
+		if recipientErr, ok := err.(*app.RecipientError); ok && recipientErr.Field < len(lines) {
+			v.Highlight = true
+			v.SelBgColor = gocui.ColorRed
+			v.SetOrigin(0, 0)
+			v.SetCursor(len([]rune(lines[recipientErr.Field])), recipientErr.Field)
+		}
+		v.Title = r.composeTitle() + " - " + err.Error()
+		return nil
+	}
+	v.Highlight = false
+	if external := r.MailHandler.ExternalRecipients(r.Params); len(external) > 0 && !r.confirmExternal {
+		r.confirmExternal = true
+		v.Title = r.composeTitle() + " - External: " + strings.Join(external, ", ") + " (confirm again to send)"
+		return nil
+	}
+	r.confirmExternal = false
+
 	_, cy := r.Views[SIDE].Cursor()
-	curThread := r.MailHandler.Threads[cy]
-	r.Params.ThreadID = curThread.ID
-	for ind, msgs := range curThread.Messages {
-		replyID += msgs.MessageID
-		if ind != len(curThread.Messages)-1 {
-			replyID += " "
+	_, oy := r.Views[SIDE].Origin()
+	if cy+oy < len(r.MailHandler.Threads) {
+		curThread := r.MailHandler.Threads[cy+oy]
+		r.Params.ThreadID = curThread.ID
+		for ind, msgs := range curThread.Messages {
+			replyID += msgs.MessageID
+			if ind != len(curThread.Messages)-1 {
+				replyID += " "
+			}
 		}
 	}
-	err := r.MailHandler.ComposeAndSend(r.Params, replyID)
+	var item *app.OutboxItem
+	var err error
+	if at.IsZero() {
+		item, err = r.MailHandler.Queue(r.Params, replyID)
+	} else {
+		item, err = r.MailHandler.QueueAt(r.Params, replyID, at)
+	}
 	if err != nil {
-		logger.NewLogger().Fatalf("Render#SendMail: Send Failed %v", err)
+		logger.NewLogger().Infof("Render#QueueMail: Queue Failed %v", err)
+		v.Title = r.composeTitle() + " - Send failed: " + err.Error()
+		return nil
+	}
+	r.lastQueued = item.ID
+	if at.IsZero() {
+		r.setStatus(fmt.Sprintf("Sending in %s - CTRL+U to undo", r.MailHandler.UndoDelay()))
+	} else {
+		r.setStatus("Scheduled for " + at.Format("2006-01-02 15:04") + " - CTRL+U to undo")
 	}
+	r.scheduleOutbox(r.MailHandler)
 	g.Update(r.renderCompose)
 	return nil
 }
 
+func (r *Render) togglePreview(g *gocui.Gui, v *gocui.View) error {
+	if _, err := g.View("preview"); err == nil {
+		return g.DeleteView("preview")
+	}
+	var body string
+	for index, line := range v.BufferLines() {
+		if index > 4 {
+			body += line + "\n"
+		}
+	}
+	params := *r.Params
+	params.Body = body
+	text, err := app.HTMLToText(r.MailHandler.RenderBody(&params))
+	if err != nil {
+		logger.NewLogger().Infof("Render#TogglePreview: Preview Failed %v", err)
+		text = body
+	}
+	maxX, maxY := g.Size()
+	view, err := g.SetView("preview", maxX/2, 0, maxX, maxY)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	view.Title = "Preview"
+	view.Wrap = true
+	fmt.Fprintf(view, "%s\n", text)
+	g.SetViewOnTop("preview")
+	return nil
+}
+
+// completeAddress completes the address under the cursor on the TO, CC and BCC
+// lines of the compose view from the local contacts.
+func (r *Render) completeAddress(g *gocui.Gui, v *gocui.View) error {
+	cx, cy := v.Cursor()
+	_, oy := v.Origin()
+	lineIndex := cy + oy
+	lines := v.BufferLines()
+	if lineIndex > 2 || lineIndex >= len(lines) || r.MailHandler.Contacts == nil {
+		return nil
+	}
+	line := []rune(lines[lineIndex])
+	if cx > len(line) {
+		cx = len(line)
+	}
+
+	c := r.completion
+	if c == nil || c.line != lineIndex || c.end != cx || c.text != string(line) || c.index >= len(c.matches) {
+		// The line or cursor changed since the last Tab, start over.
+		r.completion = nil
+		labelEnd := strings.Index(string(line), ":") + 1
+		if cx < labelEnd {
+			return nil
+		}
+		start := labelEnd
+		for i := cx - 1; i >= labelEnd; i-- {
+			if line[i] == ',' {
+				start = i + 1
+				break
+			}
+		}
+		query := strings.TrimSpace(string(line[start:cx]))
+		if query == "" {
+			return nil
+		}
+		matches := r.MailHandler.Contacts.Search(query, 10)
+		if len(matches) == 0 {
+			return nil
+		}
+		c = &completion{line: lineIndex, start: start, matches: matches, index: 0}
+		r.completion = c
+	} else {
+		c.index = (c.index + 1) % len(c.matches)
+	}
+
+	prefix := string(line[:c.start])
+	if c.start > 0 && line[c.start-1] == ',' {
+		prefix += " "
+	}
+	prefix += c.matches[c.index].String()
+	lines[lineIndex] = prefix + string(line[cx:])
+	c.end = len([]rune(prefix))
+	c.text = lines[lineIndex]
+
+	v.Clear()
+	fmt.Fprint(v, strings.Join(lines, "\n"))
+	return v.SetCursor(c.end, cy)
+}
+
+func (r *Render) toggleSignature(g *gocui.Gui, v *gocui.View) error {
+	r.Params.NoSignature = !r.Params.NoSignature
+	v.Title = r.composeTitle()
+	return nil
+}
+
+func (r *Render) cycleFrom(g *gocui.Gui, v *gocui.View) error {
+	r.Params.From = r.MailHandler.NextAlias(r.Params.From)
+	v.Title = r.composeTitle()
+	return nil
+}
+
+func (r *Render) composeTitle() string {
+	title := "Compose - From: " + r.Params.From
+	if r.Params.NoSignature {
+		title += " (no signature)"
+	}
+	return title
+}
+
 func (r *Render) markReadWrapper(g *gocui.Gui) error {
 	return r.markRead(g, r.Views[MAIN])
 }
 
 func (r *Render) markRead(g *gocui.Gui, v *gocui.View) error {
-	_, cy := r.Views[SIDE].Cursor()
-	_ = r.MailHandler.MarkAsRead(r.MailHandler.Threads[cy])
-	g.Update(r.reloadPage)
-	return nil
+	return r.applySelectionAction(g, "MarkAsRead", "read", r.MailHandler.MarkAsRead)
 }
 
 func (r *Render) scrollDown(g *gocui.Gui, v *gocui.View) error {
@@ -253,6 +442,10 @@ func (r *Render) moveToMainActionView(g *gocui.Gui, v *gocui.View) error {
 }
 
 func (r *Render) moveToActionView(viewname string, g *gocui.Gui, v *gocui.View) error {
+	if len(r.ViewButtons[viewname]) == 0 {
+		// Every action is disabled by the granted scopes.
+		return nil
+	}
 	view, err := g.SetCurrentView(viewname)
 	if err != nil {
 		logger.NewLogger().Fatalf("Render#moveToActionView: SetCurrentView Failed %v", err)
@@ -290,6 +483,7 @@ func (r *Render) mailSender(g *gocui.Gui, v *gocui.View) error {
 	thread := r.MailHandler.Threads[cy]
 	msg := thread.Messages[len(thread.Messages)-1]
 	r.setParams("reply", msg.From, msg.BCC, "", thread.Subject, "")
+	r.Params.From = r.MailHandler.ReplyAlias(msg)
 	g.Update(r.renderCompose)
 	return nil
 }
@@ -306,6 +500,16 @@ func (r *Render) handleButtonPress(g *gocui.Gui, view *gocui.View) error {
 		g.Update(r.mailSendWrapper)
 	case "MarkAsRead":
 		g.Update(r.markReadWrapper)
+	case "Archive":
+		g.Update(r.archiveWrapper)
+	case "Trash":
+		g.Update(r.trashWrapper)
+	case "Untrash":
+		g.Update(r.untrashWrapper)
+	case "Delete":
+		g.Update(r.deleteWrapper)
+	case "Filter":
+		g.Update(r.filterWrapper)
 	}
 
 	for _, button := range r.ViewButtons[view.Name()] {
@@ -396,6 +600,116 @@ func (r *Render) keybindings() error {
 	if err := g.SetKeybinding("side", gocui.KeyTab, gocui.ModNone, r.moveToSideActionView); err != nil {
 		return err
 	}
+	if err := g.SetKeybinding("side", gocui.KeySpace, gocui.ModNone, r.toggleSelect); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("side", '*', gocui.ModNone, r.selectAll); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("side", 'x', gocui.ModNone, r.unselectAll); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("side", '/', gocui.ModNone, r.openSelectPattern); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("select-pattern", gocui.KeyEnter, gocui.ModNone, r.selectByPattern); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("select-pattern", gocui.KeyCtrlQ, gocui.ModNone, r.closeSelectPattern); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("select-pattern", gocui.KeyEsc, gocui.ModNone, r.closeSelectPattern); err != nil {
+		return err
+	}
+
+	// Thread action bindings, shared by side and main views
+
+	for _, view := range []string{"side", "main"} {
+		if err := g.SetKeybinding(view, 'a', gocui.ModNone, r.archive); err != nil {
+			return err
+		}
+		if err := g.SetKeybinding(view, 't', gocui.ModNone, r.trash); err != nil {
+			return err
+		}
+		if err := g.SetKeybinding(view, 'u', gocui.ModNone, r.untrash); err != nil {
+			return err
+		}
+		if err := g.SetKeybinding(view, 'D', gocui.ModNone, r.deleteThread); err != nil {
+			return err
+		}
+		if err := g.SetKeybinding(view, 'l', gocui.ModNone, r.openLabelPicker); err != nil {
+			return err
+		}
+		if err := g.SetKeybinding(view, 's', gocui.ModNone, r.toggleStar); err != nil {
+			return err
+		}
+		if err := g.SetKeybinding(view, 'i', gocui.ModNone, r.toggleImportant); err != nil {
+			return err
+		}
+		if err := g.SetKeybinding(view, 'm', gocui.ModNone, r.mute); err != nil {
+			return err
+		}
+		if err := g.SetKeybinding(view, 'z', gocui.ModNone, r.openSnooze); err != nil {
+			return err
+		}
+		if err := g.SetKeybinding(view, 'f', gocui.ModNone, r.openFilterForm); err != nil {
+			return err
+		}
+	}
+	if err := g.SetKeybinding("filter", gocui.KeyCtrlS, gocui.ModNone, r.createFilter); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("filter", gocui.KeyCtrlQ, gocui.ModNone, r.closeFilterForm); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("snooze", gocui.KeyEnter, gocui.ModNone, r.snooze); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("snooze", gocui.KeyCtrlQ, gocui.ModNone, r.closeSnooze); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("reauth", gocui.KeyCtrlQ, gocui.ModNone, r.closeReauth); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("reauth-paste", gocui.KeyCtrlQ, gocui.ModNone, r.closeReauth); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("reauth-paste", gocui.KeyEnter, gocui.ModNone, r.submitReauthPaste); err != nil {
+		return err
+	}
+
+	// Label picker bindings
+
+	if err := g.SetKeybinding("label-filter", gocui.KeyArrowDown, gocui.ModNone, r.moveLabelCursor(1)); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("label-filter", gocui.KeyArrowUp, gocui.ModNone, r.moveLabelCursor(-1)); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("label-filter", gocui.KeyEnter, gocui.ModNone, r.toggleSelectedLabel); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("label-filter", gocui.KeyCtrlQ, gocui.ModNone, r.closeLabelPicker); err != nil {
+		return err
+	}
+
+	// Help dialog bindings
+
+	if err := g.SetKeybinding("top", gocui.KeyArrowDown, gocui.ModNone, r.scrollDown); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("top", gocui.KeyArrowUp, gocui.ModNone, r.scrollUp); err != nil {
+		return err
+	}
+
+	// Confirm dialog bindings
+
+	if err := g.SetKeybinding("confirm", 'y', gocui.ModNone, r.answerConfirm(true)); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("confirm", 'n', gocui.ModNone, r.answerConfirm(false)); err != nil {
+		return err
+	}
 
 	// Main View Bindings
 
@@ -439,12 +753,72 @@ func (r *Render) keybindings() error {
 	if err := g.SetKeybinding("", gocui.KeyCtrlC, gocui.ModNone, quit); err != nil {
 		return err
 	}
+	if err := g.SetKeybinding("", gocui.KeyCtrlU, gocui.ModNone, r.undoSend); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("", gocui.KeyCtrlO, gocui.ModNone, r.toggleOutbox); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("", gocui.KeyCtrlA, gocui.ModNone, r.openAccountSwitcher); err != nil {
+		return err
+	}
+
+	// Account switcher bindings
+
+	if err := g.SetKeybinding("accounts", gocui.KeyArrowDown, gocui.ModNone, r.moveAccountCursor(1)); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("accounts", gocui.KeyArrowUp, gocui.ModNone, r.moveAccountCursor(-1)); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("accounts", gocui.KeyEnter, gocui.ModNone, r.switchAccount); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("accounts", gocui.KeyCtrlQ, gocui.ModNone, r.closeAccountSwitcher); err != nil {
+		return err
+	}
+
+	// Outbox View Bindings
+
+	if err := g.SetKeybinding("outbox", gocui.KeyArrowDown, gocui.ModNone, cursorDown); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("outbox", gocui.KeyArrowUp, gocui.ModNone, cursorUp); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("outbox", 's', gocui.ModNone, r.sendOutboxItem); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("outbox", 'c', gocui.ModNone, r.cancelOutboxItem); err != nil {
+		return err
+	}
 
 	// Compose View Bindings
 
 	if err := g.SetKeybinding("compose", gocui.KeyCtrlS, gocui.ModNone, r.sendMail); err != nil {
 		return err
 	}
+	if err := g.SetKeybinding("compose", gocui.KeyCtrlP, gocui.ModNone, r.togglePreview); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("compose", gocui.KeyCtrlG, gocui.ModNone, r.toggleSignature); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("compose", gocui.KeyCtrlF, gocui.ModNone, r.cycleFrom); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("compose", gocui.KeyTab, gocui.ModNone, r.completeAddress); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("compose", gocui.KeyCtrlT, gocui.ModNone, r.toggleSchedule); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("schedule", gocui.KeyCtrlT, gocui.ModNone, r.toggleSchedule); err != nil {
+		return err
+	}
+	if err := g.SetKeybinding("schedule", gocui.KeyEnter, gocui.ModNone, r.scheduleMail); err != nil {
+		return err
+	}
 
 	// action view bindings
 
@@ -500,7 +874,7 @@ func (r *Render) layout(g *gocui.Gui) error {
 		if err != gocui.ErrUnknownView {
 			return err
 		}
-		r.renderButtons([]string{"Reply", "MarkAsRead"}, "mail-action", maxX/3-10, maxY-4, maxX, maxY, g)
+		r.renderButtons(r.mailActionButtons(), "mail-action", maxX/3-10, maxY-4, maxX, maxY, g)
 	}
 
 	if _, err := g.SetView("side-action", -1, maxY-4, maxX/3-10, maxY); err != nil {
@@ -525,6 +899,28 @@ func (r *Render) layout(g *gocui.Gui) error {
 	return nil
 }
 
+// mailActionButtons returns the mail actions the granted scopes allow.
+func (r *Render) mailActionButtons() []string {
+	buttons := make([]string, 0)
+	for _, button := range []struct {
+		name       string
+		capability app.Capability
+	}{
+		{"Reply", app.CapSend},
+		{"MarkAsRead", app.CapModify},
+		{"Archive", app.CapModify},
+		{"Trash", app.CapModify},
+		{"Untrash", app.CapModify},
+		{"Delete", app.CapDelete},
+		{"Filter", app.CapSettings},
+	} {
+		if r.MailHandler.Can(button.capability) {
+			buttons = append(buttons, button.name)
+		}
+	}
+	return buttons
+}
+
 func (r *Render) renderCompose(g *gocui.Gui) error {
 	maxX, maxY := g.Size()
 	_, err := g.View("compose")
@@ -538,7 +934,9 @@ func (r *Render) renderCompose(g *gocui.Gui) error {
 			fmt.Fprintf(view, "%s%s\n", "CC(comma-separated):", r.Params.Cc)
 			fmt.Fprintf(view, "%s%s\n", "BCC(comma-separated):", r.Params.Bcc)
 			fmt.Fprintf(view, "%s%s\n", "Subject:", r.Params.Subject)
-			fmt.Fprintf(view, "%s%s\n", "Body(below):", r.Params.Body)
+			fmt.Fprintf(view, "%s\n%s", "Body(below):", r.Params.Body)
+			view.Title = r.composeTitle()
+			r.confirmExternal = false
 			view.Editable = true
 			view.Wrap = true
 			g.SetViewOnTop("compose")
@@ -550,6 +948,7 @@ func (r *Render) renderCompose(g *gocui.Gui) error {
 	if err != nil {
 		return err
 	}
+	g.DeleteView("preview")
 	g.Update(func(g *gocui.Gui) error {
 		if _, err := g.SetCurrentView("main"); err != nil {
 			return err
@@ -563,7 +962,7 @@ func (r *Render) renderKeyBind(g *gocui.Gui, _ *gocui.View) error {
 	maxX, maxY := g.Size()
 	_, err := g.View("top")
 	if err != nil {
-		if v, err := g.SetView("top", maxX/2-10, maxY/2-10, maxX/2+30, maxY/2+20); err != nil {
+		if v, err := g.SetView("top", maxX/2-20, 0, maxX/2+30, maxY-1); err != nil {
 			if err != gocui.ErrUnknownView {
 				return err
 			}
@@ -575,8 +974,24 @@ func (r *Render) renderKeyBind(g *gocui.Gui, _ *gocui.View) error {
 			fmt.Fprintf(v, "%s\n", "Load Mail      - CTRL+L")
 			fmt.Fprintf(v, "%s\n", "Compose Mail      - CTRL+N")
 			fmt.Fprintf(v, "%s\n\n", "Mark as Read   - CTRL+R")
-			fmt.Fprintf(v, "%s\n\n", "Reply   - CTRL+B")
+			fmt.Fprintf(v, "%s\n", "Reply   - CTRL+B")
+			fmt.Fprintf(v, "%s\n", "Undo Send      - CTRL+U")
+			fmt.Fprintf(v, "%s\n", "Toggle Outbox  - CTRL+O")
+			fmt.Fprintf(v, "%s\n\n", "Switch Account - CTRL+A")
+			fmt.Fprintf(v, "%s\n", "---- From Side/Mail View ----")
+			fmt.Fprintf(v, "%s\n", "Archive        - a")
+			fmt.Fprintf(v, "%s\n", "Trash / Untrash - t / u")
+			fmt.Fprintf(v, "%s\n", "Delete forever - D")
+			fmt.Fprintf(v, "%s\n", "Label picker   - l")
+			fmt.Fprintf(v, "%s\n", "Star / Important - s / i")
+			fmt.Fprintf(v, "%s\n", "Mute thread    - m")
+			fmt.Fprintf(v, "%s\n", "Snooze thread  - z")
+			fmt.Fprintf(v, "%s\n\n", "Filter from mail - f")
 			fmt.Fprintf(v, "%s\n", "---- From Side View ----")
+			fmt.Fprintf(v, "%s\n", "Select / Unselect - Space")
+			fmt.Fprintf(v, "%s\n", "Select all on page - *")
+			fmt.Fprintf(v, "%s\n", "Select by pattern - /")
+			fmt.Fprintf(v, "%s\n", "Clear selection - x")
 			fmt.Fprintf(v, "%s\n", "Next Page       - Pg Dn")
 			fmt.Fprintf(v, "%s\n\n", "Prev Page      - Pg Up")
 			fmt.Fprintf(v, "%s\n\n", "Move to ActionView      - Tab")
@@ -584,9 +999,18 @@ func (r *Render) renderKeyBind(g *gocui.Gui, _ *gocui.View) error {
 			fmt.Fprintf(v, "%s\n", "Scroll Down    - Arrow Down")
 			fmt.Fprintf(v, "%s\n", "Scroll Up      - Arrow Up")
 			fmt.Fprintf(v, "%s\n\n", "Move to ActionView      - Tab")
+			fmt.Fprintf(v, "%s\n", "---- From Compose View ----")
+			fmt.Fprintf(v, "%s\n", "Send Mail      - CTRL+S")
+			fmt.Fprintf(v, "%s\n", "Toggle Preview - CTRL+P")
+			fmt.Fprintf(v, "%s\n", "Toggle Signature - CTRL+G")
+			fmt.Fprintf(v, "%s\n", "Cycle From     - CTRL+F")
+			fmt.Fprintf(v, "%s\n", "Complete Address - Tab")
+			fmt.Fprintf(v, "%s\n\n", "Schedule Send  - CTRL+T")
 			fmt.Fprintf(v, "%s\n", "---- From Action View ----")
 			fmt.Fprintf(v, "%s\n\n", "Move out of ActionView      - End")
+			v.Title = "Help - Arrow keys to scroll"
 			g.SetViewOnTop("top")
+			g.SetCurrentView("top")
 		}
 		return nil
 	}
@@ -606,6 +1030,9 @@ func (r *Render) renderKeyBind(g *gocui.Gui, _ *gocui.View) error {
 func (r *Render) renderHeader(g *gocui.Gui, headerMsg string) error {
 	r.Views[HEADER].Clear()
 	r.Views[HEADER].Highlight = true
+	if len(r.accountNames()) > 1 {
+		headerMsg += " - " + r.MailHandler.User
+	}
 	fmt.Fprintf(r.Views[HEADER], "\t\t\t\t\t\t\t\t\t\t\t\t\t\t%s", headerMsg)
 	if _, err := g.SetCurrentView("mail-top"); err != nil {
 		return err
@@ -639,7 +1066,11 @@ func (r *Render) renderSideView() {
 		return
 	}
 	for _, thread := range r.MailHandler.Threads {
-		fmt.Fprintf(r.Views[SIDE], "%s\n", thread.Subject)
+		marker := " "
+		if r.selected[thread.ID] {
+			marker = "*"
+		}
+		fmt.Fprintf(r.Views[SIDE], "%s %s\n", marker, thread.Subject)
 	}
 }
 
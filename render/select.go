@@ -0,0 +1,98 @@
+package render
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/jroimartin/gocui"
+)
+
+func (r *Render) clearSelection() {
+	r.selected = make(map[string]bool)
+}
+
+// redrawSideView re-renders the side view keeping the cursor in place.
+func (r *Render) redrawSideView() {
+	cx, cy := r.Views[SIDE].Cursor()
+	r.Views[SIDE].Clear()
+	r.renderSideView()
+	r.Views[SIDE].SetCursor(cx, cy)
+}
+
+func (r *Render) toggleSelect(g *gocui.Gui, v *gocui.View) error {
+	thread := r.currentThread()
+	if thread == nil {
+		return nil
+	}
+	if r.selected[thread.ID] {
+		delete(r.selected, thread.ID)
+	} else {
+		r.selected[thread.ID] = true
+	}
+	r.redrawSideView()
+	return cursorDown(g, v)
+}
+
+func (r *Render) selectAll(g *gocui.Gui, v *gocui.View) error {
+	for _, thread := range r.MailHandler.Threads {
+		r.selected[thread.ID] = true
+	}
+	r.redrawSideView()
+	return nil
+}
+
+func (r *Render) unselectAll(g *gocui.Gui, v *gocui.View) error {
+	r.clearSelection()
+	r.redrawSideView()
+	return nil
+}
+
+func (r *Render) openSelectPattern(g *gocui.Gui, v *gocui.View) error {
+	maxX, maxY := g.Size()
+	view, err := g.SetView("select-pattern", maxX/2-25, maxY/2-1, maxX/2+25, maxY/2+1)
+	if err != nil && err != gocui.ErrUnknownView {
+		return err
+	}
+	view.Title = "Select subjects/senders matching (regexp), CTRL+Q: cancel"
+	view.Editable = true
+	g.SetViewOnTop("select-pattern")
+	_, err = g.SetCurrentView("select-pattern")
+	return err
+}
+
+// selectByPattern selects every thread on the page whose subject or sender matches the pattern.
+func (r *Render) selectByPattern(g *gocui.Gui, v *gocui.View) error {
+	text := strings.TrimSpace(v.Buffer())
+	if text == "" {
+		// An empty pattern would match every thread.
+		return r.closeSelectPattern(g, v)
+	}
+	pattern, err := regexp.Compile("(?i)" + text)
+	if err != nil {
+		v.Title = "Invalid pattern: " + err.Error()
+		return nil
+	}
+	for _, thread := range r.MailHandler.Threads {
+		match := pattern.MatchString(thread.Subject)
+		for _, msg := range thread.Messages {
+			match = match || pattern.MatchString(msg.From)
+		}
+		if match {
+			r.selected[thread.ID] = true
+		}
+	}
+	if err := g.DeleteView("select-pattern"); err != nil {
+		return err
+	}
+	r.redrawSideView()
+	_, err = g.SetCurrentView("side")
+	return err
+}
+
+func (r *Render) closeSelectPattern(g *gocui.Gui, v *gocui.View) error {
+	if err := g.DeleteView("select-pattern"); err != nil {
+		return err
+	}
+	_, err := g.SetCurrentView("side")
+	return err
+}